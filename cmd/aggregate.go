@@ -0,0 +1,85 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// aggregateCmd represents the aggregate command
+var aggregateCmd = &cobra.Command{
+	Use:   "aggregate",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Summarize merged rows by group",
+	Long: `Pass file paths or directories as arguments, as with csv.
+
+The rows of all files are grouped by the --by columns and one row per group
+is written to aggregated.csv with the --agg summaries of its rows:
+
+  sum:COLUMN  count  count:COLUMN  min:COLUMN  max:COLUMN  mean:COLUMN  distinct:COLUMN
+
+count counts rows, count:COLUMN counts non-blank values of COLUMN and
+distinct:COLUMN counts its different values. Amounts such as "$1,250.00" or
+"(12.50)" are read as numbers.
+`,
+	Example: "aggregate . --by Category --agg sum:Amount,count\naggregate . --compute \"Month = substr(date([Transaction Date]), 0, 7)\" --by Category,Month --agg sum:Amount,mean:Amount",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := Files(args)
+		if err != nil {
+			cmd.PrintErr(err)
+			return
+		}
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+
+		groupBy, _ := cmd.Flags().GetStringSlice("by")
+		spec, _ := cmd.Flags().GetStringSlice("agg")
+		aggs, err := internal.ParseAggregates(spec)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		m.AggregateCSVFiles(files, groupBy, aggs, outputFlag(cmd))
+	},
+}
+
+// outputFlag returns the value of the --output flag, or nil when it was not
+// given so the command's default file name is used.
+func outputFlag(cmd *cobra.Command) *string {
+	if s, _ := cmd.Flags().GetString("output"); len(s) > 0 {
+		return &s
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(aggregateCmd)
+
+	aggregateCmd.Flags().StringSliceP("by", "b", nil, "Columns to group rows by")
+	aggregateCmd.Flags().StringSliceP("agg", "a", []string{"count"}, "Summaries to compute for each group, e.g. sum:Amount,count")
+	aggregateCmd.Flags().StringP("output", "o", "", "Output file name (default "+internal.DefaultAggregateFile+")")
+	addPipelineFlags(aggregateCmd)
+}
@@ -27,8 +27,8 @@ import (
 	"fmt"
 	"github.com/pgiles/merger/internal"
 	"github.com/spf13/cobra"
+	"io"
 	"os"
-	"strconv"
 	"strings"
 )
 
@@ -47,7 +47,7 @@ You can select the columns you'd like to use in the final (merged) result
 by using the interactive mode.
 `,
 
-	Example: "csv some/path/file.csv /a/file/to/append/append-me.csv\ncsv . -i\ncsv -c config.csv July",
+	Example: "csv some/path/file.csv /a/file/to/append/append-me.csv\ncsv . -i\ncsv -c config.csv July\ncsv . -w \"Category != 'Transfer' and Amount > 100\"\ncsv . --compute \"Month = substr(Date, 0, 7)\" --compute \"Vendor = upper(trim(Description))\"\ncsv . --dedupe=Date,Amount,Description --keep last\ncsv . -c config.csv --sort Date,-Amount",
 	Run: func(cmd *cobra.Command, args []string) {
 		files, err := Files(args)
 		if err != nil {
@@ -55,28 +55,91 @@ by using the interactive mode.
 			return
 		}
 
-		negateCols, _ := cmd.Flags().GetStringSlice("negate")
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+		m.Unified, _ = cmd.Flags().GetBool("unified")
+		m.OriginalHeaders, _ = cmd.Flags().GetBool("original-headers")
+		if keys, _ := cmd.Flags().GetStringSlice("sort"); len(keys) > 0 {
+			m.Sort = internal.ParseSortKeys(keys)
+		}
+		m.Order, _ = cmd.Flags().GetStringSlice("order")
+		if m.Balance, err = runningBalance(cmd); err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		include, _ := cmd.Flags().GetStringSlice("columns")
+		exclude, _ := cmd.Flags().GetStringSlice("exclude-columns")
+		if len(include) > 0 || len(exclude) > 0 {
+			if m.Select, err = internal.ParseColumnSelection(include, exclude); err != nil {
+				cmd.PrintErrln(err)
+				return
+			}
+		}
+		cfg, _ := cmd.Flags().GetString("config")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		if len(include) > 0 && (len(cfg) > 1 || interactive) {
+			cmd.PrintErrln("--columns selects the columns in place of -c and -i, use one or the other")
+			return
+		}
 
 		if b, _ := cmd.Flags().GetBool("plan"); b == true {
-			headers := internal.Headers(files)
+			headers := m.Headers(files)
 			cmd.Println(prettyPrint(headers))
 			return
 		} else if s, _ := cmd.Flags().GetString("config"); len(s) > 1 {
-			cols := internal.LoadConfigFile(s)
-			m := internal.Merger{NegateColumns: negateCols}
-			m.CombineCSVFiles(files, cols, nil)
+			c, err := internal.LoadConfig(s)
+			if err != nil {
+				cmd.PrintErrf("invalid config %s: %v\n", s, err)
+				return
+			}
+			m.Computed = append(m.Computed, c.Computed...)
+			m.Aliases, m.Rename = c.Aliases, c.Rename
+			m.NegateColumns = append(m.NegateColumns, c.Negate...)
+			matchColumns(cmd, m, files, c.Columns, nil)
+			if !checkCoverage(cmd, m, files, c.Columns, c.Optional) {
+				return
+			}
+			combine(cmd, m, files, c.Columns)
 			return
 		} else if b, _ := cmd.Flags().GetBool("interactive"); b == true {
-			headers := internal.Headers(files)
-			cmd.Println(prettyPrint(headers))
-			selected := captureInteractiveInput()
-
-			cols := matchSelected(headers, selected)
-			m := internal.Merger{GenerateConfig: true, NegateColumns: negateCols}
-			m.CombineCSVFiles(files, cols, nil)
+			info := m.Describe(files)
+			if derived := m.DerivedColumns(); len(derived) > 0 {
+				var added []internal.ColumnInfo
+				for _, d := range derived {
+					added = append(added, internal.ColumnInfo{Name: d})
+				}
+				info = append(info, added)
+			}
+			in, out := bufio.NewScanner(cmd.InOrStdin()), cmd.OutOrStdout()
+			describeColumns(out, files, info)
+			headers := columnNames(info)
+			cols, ok := selectColumns(in, out, headers)
+			if !ok {
+				return
+			}
+			matchColumns(cmd, m, files, cols, func(c internal.ColumnMatch) bool {
+				answer, _ := prompt(in, out, fmt.Sprintf("%s has no %q; use %q (%.2f)? [y/N] ", c.File, c.Column, c.Source, c.Score))
+				return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+			})
+			sel := &selection{columns: cols}
+			if !editSelection(in, out, m, files, headers, sel) {
+				return
+			}
+			if !checkCoverage(cmd, m, files, sel.columns, nil) {
+				return
+			}
+			m.Rename = sel.renames
+			m.NegateColumns = append(m.NegateColumns, sel.negate...)
+			m.GenerateConfig = true
+			combine(cmd, m, files, sel.columns)
+			return
+		} else if transforms(m) {
+			combine(cmd, m, files, nil)
 			return
 		}
-		new(internal.Merger).Merge(files, nil)
+		m.Merge(files, nil)
 	},
 }
 
@@ -105,22 +168,87 @@ func Files(args []string) ([]string, error) {
 
 	return fileList, nil
 }
-func matchSelected(headers [][]string, selected []string) []string {
-	var tmpArr []string
-	// Convert 2D array of each file's headers into a single array since that
-	// is how the input is presented (numbered)
-	for i := 0; i < len(headers); i++ {
-		for _, header := range headers[i] {
-			tmpArr = append(tmpArr, header)
+
+// combine runs m over the files, first checking that the options refer to
+// columns that will be in the output.
+func combine(cmd *cobra.Command, m *internal.Merger, files []string, cols []string) {
+	if len(m.Sort) > 0 {
+		if _, err := m.SortColumns(m.OutputHeader(files, cols)); err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+	}
+	if m.Balance != nil {
+		if err := internal.CheckBalanceColumns(m.OutputHeader(files, cols), *m.Balance); err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+	}
+	m.CombineCSVFiles(files, cols, nil)
+}
+
+// matchColumns maps the selected columns some files lack to similar columns
+// of those files, asking confirm about each proposal when set, and prints
+// the columns mapped or proposed.
+func matchColumns(cmd *cobra.Command, m *internal.Merger, files []string, cols []string, confirm func(internal.ColumnMatch) bool) {
+	f := internal.FuzzyMatch{Confirm: confirm}
+	f.Threshold, _ = cmd.Flags().GetFloat64("match-threshold")
+	if confirm != nil {
+		// every proposal is put to the user
+		f.Threshold = 2
+	}
+	for _, c := range m.MatchColumns(files, cols, f) {
+		cmd.Print(c)
+	}
+}
+
+// checkCoverage prints which of the selected columns each file has. With
+// --strict, it reports false when a file lacks a required column.
+func checkCoverage(cmd *cobra.Command, m *internal.Merger, files []string, cols []string, optional map[string]bool) bool {
+	strict, _ := cmd.Flags().GetBool("strict")
+	ok := true
+	for _, c := range m.Coverage(files, cols, optional) {
+		cmd.Print(c)
+		if strict && len(c.Missing) > 0 {
+			cmd.PrintErrf("%s: missing required columns: %s\n", c.File, strings.Join(c.Missing, ", "))
+			ok = false
 		}
 	}
+	return ok
+}
 
-	var arr []string
-	for _, x := range selected {
-		var idx, _ = strconv.Atoi(x)
-		arr = append(arr, tmpArr[idx])
+// runningBalance returns the running balance asked for by the flags, if any.
+func runningBalance(cmd *cobra.Command) (*internal.RunningBalance, error) {
+	on, _ := cmd.Flags().GetBool("running-balance")
+	check, _ := cmd.Flags().GetString("check-balance")
+	if !on && check == "" {
+		return nil, nil
+	}
+	r := &internal.RunningBalance{AmountColumn: "Amount", Check: check}
+	if s, _ := cmd.Flags().GetString("amount"); len(s) > 0 {
+		r.AmountColumn = s
+	}
+	if s, _ := cmd.Flags().GetString("opening-balance"); len(s) > 0 {
+		n, ok := internal.ParseNumber(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid --opening-balance %q", s)
+		}
+		r.Opening = &n
 	}
-	return arr
+	switch by, _ := cmd.Flags().GetString("balance-by"); by {
+	case "":
+	case "file":
+		r.ByFile = true
+	default:
+		r.By = by
+	}
+	return r, nil
+}
+
+// transforms reports whether m changes rows, in which case even a plain merge
+// goes through the row pipeline of CombineCSVFiles.
+func transforms(m *internal.Merger) bool {
+	return m.Where != nil || len(m.Computed) > 0 || len(m.Lookups) > 0 || m.Currency != nil || m.Categories != nil || m.Dedupe != nil || m.Transfers != nil || m.Unified || len(m.Sort) > 0 || m.Balance != nil || m.Select != nil || len(m.Order) > 0
 }
 func prettyPrint(headers [][]string) string {
 	var s string
@@ -134,27 +262,16 @@ func prettyPrint(headers [][]string) string {
 	}
 	return s
 }
-func captureInteractiveInput() []string {
-	// To create dynamic array
-	arr := make([]string, 0)
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Println("Press RETURN when finished.")
-	for {
-		fmt.Print("Enter Text: ")
-		// Scans a line from Stdin(Console)
-		scanner.Scan()
-		// Holds the string that scanned
-		text := scanner.Text()
-		if len(text) != 0 {
-			fmt.Println(text)
-			arr = append(arr, text)
-		} else {
-			break
-		}
 
+// prompt writes label to out and returns the next line read from in, with
+// surrounding space removed. It returns false once in is exhausted.
+func prompt(in *bufio.Scanner, out io.Writer, label string) (string, bool) {
+	fmt.Fprint(out, label)
+	if !in.Scan() {
+		fmt.Fprintln(out)
+		return "", false
 	}
-	// Use collected inputs
-	return arr
+	return strings.TrimSpace(in.Text()), true
 }
 
 func init() {
@@ -171,5 +288,19 @@ func init() {
 	csvCmd.Flags().BoolP("plan", "p", false, "Show the headers for each input file")
 	csvCmd.Flags().BoolP("interactive", "i", false, "Pick your columns interactively and store as config for future runs")
 	csvCmd.Flags().StringP("config", "c", "", "Use a set of headers configured in a single row CSV file")
-	csvCmd.Flags().StringSliceP("negate", "n", []string{}, "Column names whose negative values should be converted to positive (use with -c or -i)")
+	csvCmd.Flags().BoolP("unified", "u", false, "Write a single header row, aligning every file's rows to it")
+	csvCmd.Flags().Float64("match-threshold", internal.DefaultMatchThreshold, "Similarity, from 0 to 1, from which a file's column is read as a selected column it lacks (above 1 to disable)")
+	csvCmd.Flags().StringSlice("columns", nil, "Columns to write, by name, /REGEX/ or position in each file counting from 1, e.g. Date,/^Amount/,5-7")
+	csvCmd.Flags().StringSlice("exclude-columns", nil, "Columns to leave out, by name, /REGEX/ or position, e.g. ssn,/^Internal/")
+	csvCmd.Flags().StringSlice("order", nil, "Columns, by output or input name, written first and in this order")
+	csvCmd.Flags().Bool("strict", false, "Fail when a file lacks a selected column not marked optional with a trailing ? in the config")
+	csvCmd.Flags().Bool("original-headers", false, "Write column names as spelled in the input files instead of as in the selected columns")
+	csvCmd.Flags().StringSliceP("sort", "s", nil, "Sort the merged rows by columns, prefix with - for descending, e.g. Date,-Amount (implies -u)")
+	csvCmd.Flags().Bool("running-balance", false, "Add a RunningBalance column totalling --amount over the output rows (implies -u)")
+	csvCmd.Flags().String("amount", "Amount", "Column holding each row's amount, totalled by --running-balance and read by --transfers and --convert-to")
+	csvCmd.Flags().String("opening-balance", "", "Balance before the first row (default 0, or inferred when checking)")
+	csvCmd.Flags().String("balance-by", "", "Keep a running balance per input file (file) or per value of a column, e.g. Account")
+	csvCmd.Flags().String("check-balance", "", "Compare the running balance with the bank's balance column and add a BalanceDiff column (implies --running-balance)")
+	csvCmd.Flags().Lookup("check-balance").NoOptDefVal = "Balance"
+	addPipelineFlags(csvCmd)
 }
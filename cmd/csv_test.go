@@ -1,36 +1,51 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
 func TestMatchSelected(t *testing.T) {
+	headers := [][]string{
+		{"Transaction Date", "Post Date", "Category", "Amount"},
+		{"Field", "Type", "Null", "Key", "Default", "Extra"},
+	}
 	var tests = []struct {
-		headers  [][]string
 		selected []string
 		want     []string
+		err      bool
 	}{
-		{
-			[][]string{
-				{"Transaction Date", "Post Date", "Category", "Amount"},
-				{"Field", "Type", "Null", "Key", "Default", "Extra"},
-			},
-			[]string{"0", "3", "4"},
-			[]string{"Transaction Date", "Amount", "Default"},
-		},
+		{[]string{"0", "3", "4"}, []string{"Transaction Date", "Amount", "Field"}, false},
+		{[]string{"0-2,Amount"}, []string{"Transaction Date", "Post Date", "Category", "Amount"}, false},
+		{[]string{"amount, 8-9, 3"}, []string{"Amount", "Default", "Extra"}, false},
+		{[]string{"10"}, nil, true},
+		{[]string{"Balance"}, nil, true},
+		{[]string{"3-1"}, nil, true},
 	}
 
 	//t.Run enables running “subtests”, one for each table entry. These are shown separately when executing go test -v.
 	for _, tt := range tests {
-		testName := fmt.Sprintf("%s", tt.headers)
+		testName := fmt.Sprintf("%s", tt.selected)
 		t.Run(testName, func(t *testing.T) {
-			ans := matchSelected(tt.headers, tt.selected)
-			if reflect.DeepEqual(ans, tt.want) {
+			ans, err := matchSelected(headers, tt.selected)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(ans, tt.want) {
 				t.Errorf("got: '%s', want: '%s'", ans, tt.want)
 			}
 		})
@@ -79,3 +94,294 @@ func TestCSV(t *testing.T) {
 	}
 
 }
+
+func TestAggregateCmd(t *testing.T) {
+	defer func() {
+		_ = os.Remove(internal.DefaultAggregateFile)
+	}()
+
+	cmd := rootCmd.Root()
+	cmd.SetArgs([]string{"aggregate", "./fixtures/transactions.CSV", "--by", "Category", "--agg", "sum:Amount"})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(internal.DefaultAggregateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Category,sum(Amount)\nDining,39.98\nGrocery,68.77\nMerchandise,12.36\n"
+	if string(b) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestReview(t *testing.T) {
+	dir := t.TempDir()
+	merged := filepath.Join(dir, "merged.csv")
+	if err := os.WriteFile(merged, []byte("Description,Amount,Category\nCoffee,-4.50,\nPayroll,2000.00,\nRent,-1200.00,\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := internal.NewCategorizer()
+	c.File = filepath.Join(dir, "rules.csv")
+	r, err := internal.NewReview(merged, c, internal.DefaultReviewBelow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assign with a rule, undo it, skip, assign without a rule and quit
+	in := bufio.NewScanner(strings.NewReader("Dining\ncoffee\nu\ns\nIncome\n\nq\n"))
+	out := bytes.NewBufferString("")
+	finished, err := review(in, out, r)
+	if err != nil || finished {
+		t.Fatalf("review() = %v, %v, want unfinished", finished, err)
+	}
+	want := []internal.Decision{{Row: 1}, {Row: 2, Category: "Income"}}
+	if !reflect.DeepEqual(r.Decisions, want) {
+		t.Errorf("got decisions %+v, want %+v\n%s", r.Decisions, want, out)
+	}
+}
+
+func TestPicker(t *testing.T) {
+	m := new(internal.Merger)
+	files := []string{"./fixtures/transactions.CSV"}
+	headers := columnNames(m.Describe(files))
+	// a bad list, then a good one, then edit and merge
+	in := bufio.NewScanner(strings.NewReader("Balance\n0,2-3\nremove Category\nadd 1\norder Amount\nrename Amount -> amt\nnegate 3\nnegate Category\nbogus\npreview\n\n"))
+	out := bytes.NewBufferString("")
+	cols, ok := selectColumns(in, out, headers)
+	if !ok {
+		t.Fatal("selectColumns() quit")
+	}
+	sel := &selection{columns: cols}
+	if !editSelection(in, out, m, files, headers, sel) {
+		t.Fatalf("editSelection() quit\n%s", out)
+	}
+	want := &selection{
+		columns: []string{"Amount", "Transaction Date", "Post Date"},
+		renames: map[string]string{"Amount": "amt"},
+		negate:  []string{"Amount"},
+	}
+	if !reflect.DeepEqual(sel, want) {
+		t.Errorf("got %+v, want %+v\n%s", sel, want, out)
+	}
+	for _, s := range []string{`no column "Balance"`, `"Category" is not selected`, `unknown command "bogus"`, "amt,Transaction Date,Post Date\n-12.36,20221231,2022\n"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output lacks %q:\n%s", s, out)
+		}
+	}
+}
+
+func TestUI(t *testing.T) {
+	dir := t.TempDir()
+	b := &configBuilder{
+		merger: new(internal.Merger),
+		dir:    dir,
+		config: filepath.Join(dir, "cfg.csv"),
+		out:    io.Discard,
+		files:  []string{"./fixtures/bank.csv"},
+	}
+	h := localOnly(b.handler())
+	do := func(method, url, body, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Host = "localhost:8080"
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("GET", "/", "", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("GET / = %d", w.Code)
+	}
+	req := httptest.NewRequest("GET", "/files", nil)
+	req.Host = "attacker.example:8080"
+	rec := httptest.NewRecorder()
+	if h.ServeHTTP(rec, req); rec.Code != http.StatusForbidden {
+		t.Errorf("request for another host = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// a dropped file joins the one given on the command line
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "card_export.csv")
+	content, _ := os.ReadFile("./fixtures/card_export.csv")
+	fw.Write(content)
+	mw.Close()
+	w := do("POST", "/upload", form.String(), mw.FormDataContentType())
+	var files struct {
+		Files []uiFile
+	}
+	if err := json.NewDecoder(w.Body).Decode(&files); err != nil || len(files.Files) != 2 {
+		t.Fatalf("POST /upload = %d, %v, %+v", w.Code, err, files)
+	}
+	dropped := files.Files[1]
+	if dropped.Name != "card_export.csv" || dropped.Columns[3].Name != "Amt" || dropped.Columns[3].Kind != "number" {
+		t.Errorf("dropped file = %+v", dropped)
+	}
+
+	plan := `{"columns":[{"name":"Date"},{"name":"Amount","rename":"amount","negate":true,"sources":{"` + dropped.Path + `":"Amt"}}]}`
+	w = do("POST", "/preview", plan, "application/json")
+	var p uiPreview
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("POST /preview = %d, %v", w.Code, err)
+	}
+	if want := []string{"Date", "amount"}; !reflect.DeepEqual(p.Header, want) {
+		t.Errorf("preview header = %q, want %q", p.Header, want)
+	}
+	// card_export.csv has no Date but its Amt is read as Amount
+	if want := []string{"", "-45.10"}; len(p.Rows) != 7 || !reflect.DeepEqual(p.Rows[5], want) {
+		t.Errorf("preview rows = %q, want %q sixth", p.Rows, want)
+	}
+	if len(p.Missing) != 1 || p.Missing[0].Columns[0] != "Date" || len(p.Suggestions) == 0 || p.Suggestions[0].Source != "Trans. Date" {
+		t.Errorf("preview missing = %+v, suggestions = %+v", p.Missing, p.Suggestions)
+	}
+
+	if w := do("POST", "/save", plan, "application/json"); w.Code != http.StatusOK {
+		t.Fatalf("POST /save = %d %s", w.Code, w.Body)
+	}
+	c, err := internal.LoadConfig(b.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Columns, []string{"Date", "Amount"}) || c.Rename["Amount"] != "amount" || !reflect.DeepEqual(c.Negate, []string{"Amount"}) || !reflect.DeepEqual(c.Aliases["Amount"], []string{"Amt"}) {
+		t.Errorf("saved config = %+v", c)
+	}
+	if w := do("POST", "/save", `{"columns":[]}`, "application/json"); w.Code != http.StatusBadRequest {
+		t.Errorf("saving no columns = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// other sites' pages may not change anything
+	evil := `{"columns":[{"name":"Evil = 1"}]}`
+	for _, tt := range []struct {
+		name, header, value, contentType string
+		want                             int
+	}{
+		{"other origin", "Origin", "http://attacker.example", "application/json", http.StatusForbidden},
+		{"null origin", "Origin", "null", "application/json", http.StatusForbidden},
+		{"cross-site fetch", "Sec-Fetch-Site", "cross-site", "application/json", http.StatusForbidden},
+		{"form post", "Origin", "http://localhost:8080", "text/plain", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/save", strings.NewReader(evil))
+		req.Host = "localhost:8080"
+		req.Header.Set(tt.header, tt.value)
+		req.Header.Set("Content-Type", tt.contentType)
+		rec := httptest.NewRecorder()
+		if h.ServeHTTP(rec, req); rec.Code != tt.want {
+			t.Errorf("%s: POST /save = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+	if c, err := internal.LoadConfig(b.config); err != nil || len(c.Computed) > 0 {
+		t.Errorf("a cross-origin request changed the config: %+v, %v", c, err)
+	}
+	req = httptest.NewRequest("POST", "/files", strings.NewReader(`{"remove":["./fixtures/bank.csv"]}`))
+	req.Host = "localhost:8080"
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	if h.ServeHTTP(rec, req); rec.Code != http.StatusOK {
+		t.Errorf("same-origin POST /files = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestUIConcurrent(t *testing.T) {
+	rules, err := internal.LoadRules("./fixtures/rules.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	b := &configBuilder{
+		merger: &internal.Merger{Layout: internal.Layout{TrimFooter: true}, Categories: rules},
+		dir:    dir,
+		config: filepath.Join(dir, "cfg.csv"),
+		out:    io.Discard,
+	}
+	h := localOnly(b.handler())
+	do := func(method, url, body, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Host = "localhost:8080"
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// files of the same name are both kept
+	for _, fixture := range []string{"./fixtures/bank_export.csv", "./fixtures/bank.csv"} {
+		var form bytes.Buffer
+		mw := multipart.NewWriter(&form)
+		fw, _ := mw.CreateFormFile("file", "statement.csv")
+		content, _ := os.ReadFile(fixture)
+		fw.Write(content)
+		mw.Close()
+		if w := do("POST", "/upload", form.String(), mw.FormDataContentType()); w.Code != http.StatusOK {
+			t.Fatalf("POST /upload = %d %s", w.Code, w.Body)
+		}
+	}
+	files := b.list()
+	if len(files) != 2 || files[0] == files[1] {
+		t.Fatalf("uploaded files = %q, want two", files)
+	}
+	for _, f := range files {
+		if filepath.Base(f) != "statement.csv" {
+			t.Errorf("uploaded file %s, want it named statement.csv", f)
+		}
+	}
+
+	plan := `{"columns":[{"name":"Date"},{"name":"Description"},{"name":"Amount"},{"name":"Category"}]}`
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if w := do("GET", "/files", "", ""); w.Code != http.StatusOK {
+				t.Errorf("GET /files = %d", w.Code)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if w := do("POST", "/preview", plan, "application/json"); w.Code != http.StatusOK {
+				t.Errorf("POST /preview = %d %s", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPipelineDateAndAmount(t *testing.T) {
+	var tests = []struct {
+		args         []string
+		date, amount string
+		wantErr      bool
+	}{
+		{[]string{"--transfers"}, "Date", "Amount", false},
+		{[]string{"--transfers", "--convert-to", "USD", "--rates-file", "./fixtures/rates.csv", "--date", "Transaction Date", "--amount", "Amt"}, "Transaction Date", "Amt", false},
+		{[]string{"--transfers", "--date", "Date=Posted"}, "", "", true},
+		{[]string{"--convert-to", "USD", "--rates-file", "./fixtures/rates.csv", "--amount", "Date=Posted"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			c := &cobra.Command{}
+			addPipelineFlags(c)
+			if err := c.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			c.SetErr(io.Discard)
+			m := pipelineMerger(c)
+			if tt.wantErr {
+				if m != nil {
+					t.Error("pipelineMerger() should fail")
+				}
+				return
+			}
+			if m == nil || m.Transfers.DateColumn != tt.date || m.Transfers.AmountColumn != tt.amount {
+				t.Errorf("pipelineMerger() = %+v, want transfers on %s and %s", m, tt.date, tt.amount)
+			}
+			if m.Currency != nil && (m.Currency.DateColumn != tt.date || m.Currency.AmountColumn != tt.amount) {
+				t.Errorf("pipelineMerger() converts %s on %s, want %s on %s", m.Currency.AmountColumn, m.Currency.DateColumn, tt.amount, tt.date)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// joinCmd represents the join command
+var joinCmd = &cobra.Command{
+	Use:   "join LEFT RIGHT",
+	Args:  cobra.ExactArgs(2),
+	Short: "Join the rows of two CSV files on key columns",
+	Long: `Pass the two files to join. Rows whose --on columns are equal are combined
+into one row of joined.csv holding the key columns followed by the other
+columns of the left and then the right file. Columns other than the keys
+found in both files are prefixed with the file name, or --prefix.
+
+--type inner keeps matched rows only; left, right and full also keep the
+unmatched rows of the left, right or both files with blanks for the other.
+Blank keys never match.
+
+The smaller file is held in memory while the larger one is streamed, so
+joined rows follow the order of the larger file, followed by any unmatched
+rows of the smaller one.
+`,
+	Example: "join fixtures/test.csv fixtures/accounts.csv --on ssn\njoin ledger.csv bank.csv --on Date,Ref=Reference --type full --prefix ledger_,bank_",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := Files(args)
+		if err != nil {
+			cmd.PrintErr(err)
+			return
+		}
+		if len(files) != 2 {
+			cmd.PrintErrln("join needs exactly two CSV files")
+			return
+		}
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+
+		var j internal.Join
+		on, _ := cmd.Flags().GetStringSlice("on")
+		j.LeftKey, j.RightKey = internal.ParseJoinKeys(on)
+		j.Type, _ = cmd.Flags().GetString("type")
+		if prefix, _ := cmd.Flags().GetStringSlice("prefix"); len(prefix) > 0 {
+			if len(prefix) != 2 {
+				cmd.PrintErrln("--prefix takes two values: LEFT,RIGHT")
+				return
+			}
+			j.LeftPrefix, j.RightPrefix = prefix[0], prefix[1]
+		}
+		if err := m.JoinCSVFiles(files[0], files[1], j, outputFlag(cmd)); err != nil {
+			cmd.PrintErrln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(joinCmd)
+
+	joinCmd.Flags().StringSlice("on", nil, "Key columns, NAME or LEFT=RIGHT when named differently")
+	joinCmd.Flags().StringP("type", "t", "inner", "Join type: inner, left, right or full")
+	joinCmd.Flags().StringSlice("prefix", nil, "Prefixes for colliding column names, LEFT,RIGHT (default file names)")
+	joinCmd.Flags().StringP("output", "o", "", "Output file name (default "+internal.DefaultJoinFile+")")
+	_ = joinCmd.MarkFlagRequired("on")
+	addPipelineFlags(joinCmd)
+}
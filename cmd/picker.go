@@ -0,0 +1,361 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pgiles/merger/internal"
+)
+
+// previewLines is the number of output lines shown by the picker's preview.
+const previewLines = 8
+
+// selection is the columns chosen in the interactive picker, in output
+// order, with their output names and the columns whose values are negated.
+type selection struct {
+	columns []string
+	renames map[string]string
+	negate  []string
+}
+
+// describeColumns writes the columns of each file, numbered across files as
+// understood by matchSelected, with the kind and a few of their values.
+// Columns added by the row pipeline come last.
+func describeColumns(out io.Writer, files []string, info [][]internal.ColumnInfo) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	n := 0
+	for i, cols := range info {
+		if i < len(files) {
+			fmt.Fprintln(tw, files[i])
+		} else {
+			fmt.Fprintln(tw, "added columns")
+		}
+		for _, c := range cols {
+			fmt.Fprintf(tw, "  [%d]\t%s\t%s\t%s\n", n, c.Name, c.Kind, strings.Join(c.Samples, ", "))
+			n++
+		}
+	}
+	tw.Flush()
+}
+
+// columnNames returns the names of the described columns, file by file.
+func columnNames(info [][]internal.ColumnInfo) [][]string {
+	headers := make([][]string, len(info))
+	for i, cols := range info {
+		for _, c := range cols {
+			headers[i] = append(headers[i], c.Name)
+		}
+	}
+	return headers
+}
+
+// selectColumns asks for the columns to merge until a valid list is given;
+// RETURN takes every column. It reports false once in is exhausted.
+func selectColumns(in *bufio.Scanner, out io.Writer, headers [][]string) ([]string, bool) {
+	for {
+		answer, ok := prompt(in, out, "Columns, by number, range or name (e.g. 0-3,Amount), RETURN for all: ")
+		if !ok {
+			return nil, false
+		}
+		if answer == "" {
+			cols, _ := matchSelected(headers, []string{fmt.Sprintf("0-%d", countColumns(headers)-1)})
+			return cols, true
+		}
+		cols, err := matchSelected(headers, []string{answer})
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		return cols, true
+	}
+}
+
+func countColumns(headers [][]string) int {
+	n := 0
+	for _, h := range headers {
+		n += len(h)
+	}
+	return n
+}
+
+// editSelection lets the user add, remove, reorder, rename and negate the
+// selected columns and preview the merge, until RETURN. It reports false
+// when the user quits.
+func editSelection(in *bufio.Scanner, out io.Writer, m *internal.Merger, files []string, headers [][]string, sel *selection) bool {
+	fmt.Fprintln(out, "Commands: add LIST, remove LIST, order LIST, rename COLUMN -> NAME, negate LIST, preview, q to quit.")
+	fmt.Fprintln(out, "LIST is numbers, ranges or names as above. Press RETURN to merge.")
+	for {
+		fmt.Fprintln(out, "Selected:", describeSelection(sel))
+		answer, ok := prompt(in, out, "> ")
+		if !ok || answer == "q" {
+			return false
+		}
+		command, arg, _ := strings.Cut(answer, " ")
+		arg = strings.TrimSpace(arg)
+		var err error
+		switch command {
+		case "":
+			if len(sel.columns) == 0 {
+				fmt.Fprintln(out, "Select at least one column.")
+				continue
+			}
+			return true
+		case "add":
+			err = sel.add(headers, arg)
+		case "remove":
+			err = sel.remove(headers, arg)
+		case "order":
+			err = sel.order(headers, arg)
+		case "rename":
+			err = sel.rename(arg)
+		case "negate":
+			err = sel.toggleNegate(headers, arg)
+		case "preview":
+			p := *m
+			p.Rename = sel.renames
+			p.NegateColumns = append(append([]string{}, m.NegateColumns...), sel.negate...)
+			fmt.Fprint(out, p.Preview(files, sel.columns, previewLines))
+		default:
+			err = fmt.Errorf("unknown command %q", command)
+		}
+		if err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+}
+
+func describeSelection(sel *selection) string {
+	var cols []string
+	for i, c := range sel.columns {
+		s := fmt.Sprintf("%d:%s", i+1, c)
+		if to, ok := sel.renames[c]; ok {
+			s += " -> " + to
+		}
+		for _, n := range sel.negate {
+			if n == c {
+				s += " (negated)"
+			}
+		}
+		cols = append(cols, s)
+	}
+	if len(cols) == 0 {
+		return "none"
+	}
+	return strings.Join(cols, ", ")
+}
+
+func (sel *selection) has(col string) bool {
+	for _, c := range sel.columns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// selected resolves list to columns of the selection.
+func (sel *selection) selected(headers [][]string, list string) ([]string, error) {
+	cols, err := matchSelected(headers, []string{list})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cols {
+		if !sel.has(c) {
+			return nil, fmt.Errorf("%q is not selected", c)
+		}
+	}
+	return cols, nil
+}
+
+func (sel *selection) add(headers [][]string, list string) error {
+	cols, err := matchSelected(headers, []string{list})
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if !sel.has(c) {
+			sel.columns = append(sel.columns, c)
+		}
+	}
+	return nil
+}
+
+func (sel *selection) remove(headers [][]string, list string) error {
+	cols, err := sel.selected(headers, list)
+	if err != nil {
+		return err
+	}
+	drop := make(map[string]bool)
+	for _, c := range cols {
+		drop[c] = true
+	}
+	var kept []string
+	for _, c := range sel.columns {
+		if !drop[c] {
+			kept = append(kept, c)
+		}
+	}
+	sel.columns = kept
+	return nil
+}
+
+// order puts the columns of list first, in its order.
+func (sel *selection) order(headers [][]string, list string) error {
+	cols, err := sel.selected(headers, list)
+	if err != nil {
+		return err
+	}
+	first := make(map[string]bool)
+	for _, c := range cols {
+		first[c] = true
+	}
+	for _, c := range sel.columns {
+		if !first[c] {
+			cols = append(cols, c)
+		}
+	}
+	sel.columns = cols
+	return nil
+}
+
+func (sel *selection) rename(arg string) error {
+	from, to, err := internal.ParseRename(arg)
+	if err != nil {
+		return err
+	}
+	if !sel.has(from) {
+		return fmt.Errorf("%q is not selected", from)
+	}
+	if sel.renames == nil {
+		sel.renames = make(map[string]string)
+	}
+	sel.renames[from] = to
+	return nil
+}
+
+func (sel *selection) toggleNegate(headers [][]string, list string) error {
+	cols, err := sel.selected(headers, list)
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		negated := false
+		for i, n := range sel.negate {
+			if n == c {
+				sel.negate = append(sel.negate[:i], sel.negate[i+1:]...)
+				negated = true
+				break
+			}
+		}
+		if !negated {
+			sel.negate = append(sel.negate, c)
+		}
+	}
+	return nil
+}
+
+// matchSelected returns the columns named by the entries of selected, each
+// a comma separated list of column numbers as shown by prettyPrint, ranges
+// of them such as 0-3, and column names. Columns are returned once, in the
+// order given.
+func matchSelected(headers [][]string, selected []string) ([]string, error) {
+	var all []string
+	// Convert 2D array of each file's headers into a single array since that
+	// is how the input is presented (numbered)
+	for i := 0; i < len(headers); i++ {
+		all = append(all, headers[i]...)
+	}
+
+	var cols []string
+	seen := make(map[string]bool)
+	add := func(c string) {
+		if !seen[c] {
+			seen[c] = true
+			cols = append(cols, c)
+		}
+	}
+	for _, entry := range selected {
+		for _, item := range strings.Split(entry, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			from, to, err := columnRange(item)
+			if err != nil {
+				name, ok := findColumn(all, item)
+				if !ok {
+					return nil, fmt.Errorf("no column %q", item)
+				}
+				add(name)
+				continue
+			}
+			if to >= len(all) {
+				return nil, fmt.Errorf("no column %d, the last is %d", to, len(all)-1)
+			}
+			for i := from; i <= to; i++ {
+				add(all[i])
+			}
+		}
+	}
+	return cols, nil
+}
+
+// columnRange reads a column number or a range of them such as 2-5.
+func columnRange(item string) (int, int, error) {
+	a, b, isRange := strings.Cut(item, "-")
+	from, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil {
+		return 0, 0, err
+	}
+	to := from
+	if isRange {
+		if to, err = strconv.Atoi(strings.TrimSpace(b)); err != nil {
+			return 0, 0, err
+		}
+	}
+	if from < 0 || to < from {
+		return 0, 0, fmt.Errorf("invalid range %s", item)
+	}
+	return from, to, nil
+}
+
+// findColumn returns the column of all named name, exactly or as read by
+// NormalizeHeader.
+func findColumn(all []string, name string) (string, bool) {
+	for _, c := range all {
+		if c == name {
+			return c, true
+		}
+	}
+	for _, c := range all {
+		if internal.NormalizeHeader(c) == internal.NormalizeHeader(name) {
+			return c, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// addPipelineFlags defines the flags that shape the rows read from the input
+// files, shared by every command built on the merge pipeline.
+func addPipelineFlags(c *cobra.Command) {
+	// commands reading the date and amount themselves define these first
+	if c.Flags().Lookup("date") == nil {
+		c.Flags().String("date", "Date", "Column holding each row's date, read by --transfers and --convert-to")
+	}
+	if c.Flags().Lookup("amount") == nil {
+		c.Flags().String("amount", "Amount", "Column holding each row's amount, read by --transfers and --convert-to")
+	}
+	c.Flags().Int("header-row", 0, "Line number of the header row in every file (default: detected, skipping preamble lines)")
+	c.Flags().String("skip-until", "", "Take the first line matching a regular expression as the header row")
+	c.Flags().Bool("trim-footer", false, "Drop trailing total lines, such as Total or Closing balance, reporting each on stderr")
+	c.Flags().StringArray("no-header", []string{}, "A file without a header line, FILE or FILE=NAME,NAME,...; columns are named col1..colN unless named, '*' for every file (repeatable)")
+	c.Flags().StringSliceP("negate", "n", []string{}, "Column names whose negative values should be converted to positive (use with -c or -i)")
+	c.Flags().StringSlice("dedupe", nil, "Drop duplicate rows across files; --dedupe compares whole rows, --dedupe=Date,Amount compares those columns")
+	c.Flags().Lookup("dedupe").NoOptDefVal = "*"
+	c.Flags().String("keep", "first", "Which of a set of duplicate rows to keep with --dedupe: first or last")
+	c.Flags().StringArray("compute", []string{}, "Add a column computed from others, e.g. \"Net = Credit - Debit\" (repeatable)")
+	c.Flags().StringArray("lookup", []string{}, "Add columns from a reference table, FILE:REFKEY=KEY:COLUMNS[:exact|icase|prefix|contains|regex] (repeatable)")
+	c.Flags().String("convert-to", "", "Convert the --amount column to a currency, e.g. USD, using the rates of --rates-file")
+	c.Flags().String("rates-file", "", "CSV file of exchange rates with the columns Date,From,To,Rate")
+	c.Flags().String("currency-column", "Currency", "Column holding each row's currency")
+	c.Flags().StringArray("currency", []string{}, "Currency of the rows of a file lacking a currency column, FILE=CURRENCY (repeatable)")
+	c.Flags().String("rules", "", "Categorize rows with the rules of a CSV rule file, filling in blank Category and Tags columns")
+	c.Flags().Bool("override", false, "Let --rules replace categories rows already have")
+	c.Flags().Bool("transfers", false, "Tag rows moving money between files (opposite --amount within a few days of --date) with a TransferID")
+	c.Flags().Int("transfer-days", internal.DefaultTransferDays, "Days the two sides of a transfer may be apart")
+	c.Flags().Bool("drop-transfers", false, "Leave out the rows of transfers, e.g. from spend reports (implies --transfers)")
+	c.Flags().StringP("where", "w", "", "Keep only rows matching an expression, e.g. \"Category != 'Transfer' and Amount > 100\"")
+}
+
+// pipelineMerger returns a Merger configured from the flags defined by
+// addPipelineFlags. Invalid flags are reported and nil is returned.
+func pipelineMerger(cmd *cobra.Command) *internal.Merger {
+	var err error
+	negateCols, _ := cmd.Flags().GetStringSlice("negate")
+	m := &internal.Merger{NegateColumns: negateCols}
+	m.Layout.HeaderRow, _ = cmd.Flags().GetInt("header-row")
+	if m.Layout.HeaderRow < 0 {
+		cmd.PrintErrf("invalid --header-row %d\n", m.Layout.HeaderRow)
+		return nil
+	}
+	if s, _ := cmd.Flags().GetString("skip-until"); len(s) > 0 {
+		if m.Layout.SkipUntil, err = regexp.Compile(s); err != nil {
+			cmd.PrintErrf("invalid --skip-until: %v\n", err)
+			return nil
+		}
+	}
+	m.Layout.TrimFooter, _ = cmd.Flags().GetBool("trim-footer")
+	if specs, _ := cmd.Flags().GetStringArray("no-header"); len(specs) > 0 {
+		if m.Layout.NoHeader, err = internal.ParseNoHeader(specs); err != nil {
+			cmd.PrintErrln(err)
+			return nil
+		}
+	}
+	if s, _ := cmd.Flags().GetString("where"); len(s) > 0 {
+		if m.Where, err = internal.ParseExpr(s); err != nil {
+			cmd.PrintErrf("invalid --where expression: %v\n", err)
+			return nil
+		}
+	}
+	defs, _ := cmd.Flags().GetStringArray("compute")
+	for _, def := range defs {
+		c, err := internal.ParseComputed(def)
+		if err != nil {
+			cmd.PrintErrf("invalid --compute column: %v\n", err)
+			return nil
+		}
+		m.Computed = append(m.Computed, c)
+	}
+	specs, _ := cmd.Flags().GetStringArray("lookup")
+	for _, spec := range specs {
+		l, err := internal.ParseLookup(spec)
+		if err != nil {
+			cmd.PrintErrf("invalid --lookup: %v\n", err)
+			return nil
+		}
+		m.Lookups = append(m.Lookups, l)
+	}
+	if target, _ := cmd.Flags().GetString("convert-to"); len(target) > 0 {
+		file, _ := cmd.Flags().GetString("rates-file")
+		if len(file) == 0 {
+			cmd.PrintErrln("--convert-to needs a --rates-file")
+			return nil
+		}
+		c := &internal.Conversion{Target: target}
+		if c.DateColumn, c.AmountColumn, err = dateAndAmount(cmd); err != nil {
+			cmd.PrintErrf("invalid --convert-to: %v\n", err)
+			return nil
+		}
+		c.CurrencyColumn, _ = cmd.Flags().GetString("currency-column")
+		if c.Rates, err = internal.LoadRates(file); err != nil {
+			cmd.PrintErrf("invalid --rates-file: %v\n", err)
+			return nil
+		}
+		specs, _ := cmd.Flags().GetStringArray("currency")
+		if c.FileCurrency, err = internal.ParseFileCurrencies(specs); err != nil {
+			cmd.PrintErrln(err)
+			return nil
+		}
+		m.Currency = c
+	}
+	if file, _ := cmd.Flags().GetString("rules"); len(file) > 0 {
+		if m.Categories, err = internal.LoadRules(file); err != nil {
+			cmd.PrintErrf("invalid --rules: %v\n", err)
+			return nil
+		}
+		m.Categories.Override, _ = cmd.Flags().GetBool("override")
+	}
+	transfers, _ := cmd.Flags().GetBool("transfers")
+	drop, _ := cmd.Flags().GetBool("drop-transfers")
+	if transfers || drop {
+		days, _ := cmd.Flags().GetInt("transfer-days")
+		if days < 0 {
+			cmd.PrintErrf("invalid --transfer-days %d\n", days)
+			return nil
+		}
+		m.Transfers = &internal.Transfers{Days: days, Drop: drop}
+		if m.Transfers.DateColumn, m.Transfers.AmountColumn, err = dateAndAmount(cmd); err != nil {
+			cmd.PrintErrf("invalid --transfers: %v\n", err)
+			return nil
+		}
+	}
+	if key, _ := cmd.Flags().GetStringSlice("dedupe"); len(key) > 0 {
+		m.Dedupe = &internal.Dedupe{}
+		if key[0] != "*" {
+			m.Dedupe.Key = key
+		}
+		keep, _ := cmd.Flags().GetString("keep")
+		switch keep {
+		case "first":
+		case "last":
+			m.Dedupe.KeepLast = true
+		default:
+			cmd.PrintErrf("invalid --keep %q: use first or last\n", keep)
+			return nil
+		}
+	}
+	return m
+}
+
+// dateAndAmount returns the date and amount columns named by --date and
+// --amount, which must name a single column for the pipeline.
+func dateAndAmount(cmd *cobra.Command) (date, amount string, err error) {
+	date, _ = cmd.Flags().GetString("date")
+	amount, _ = cmd.Flags().GetString("amount")
+	for _, c := range []string{date, amount} {
+		if strings.Contains(c, "=") {
+			return "", "", fmt.Errorf("--date and --amount must name one column, not %s", c)
+		}
+	}
+	return date, amount, nil
+}
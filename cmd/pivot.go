@@ -0,0 +1,87 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/csv"
+
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// pivotCmd represents the pivot command
+var pivotCmd = &cobra.Command{
+	Use:   "pivot",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Turn the values of a column into columns (long to wide)",
+	Long: `Pass file paths or directories as arguments, as with csv.
+
+Each file is pivoted on its own and written under the same name to the
+reshaped directory (or --dir), ready to be merged with csv. Every distinct
+value of the --column column becomes a column; rows are grouped by the
+--rows columns and each cell holds the --agg (sum, count, min, max, mean or
+distinct) of the --value column.
+`,
+	Example: "pivot . --rows Category --column Month --value Amount\npivot statement.csv --compute \"Month = substr(date(Date), 0, 7)\" -r Category -k Month -v Amount -a mean",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := Files(args)
+		if err != nil {
+			cmd.PrintErr(err)
+			return
+		}
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+
+		var p internal.Pivot
+		p.Rows, _ = cmd.Flags().GetStringSlice("rows")
+		p.Column, _ = cmd.Flags().GetString("column")
+		p.Value, _ = cmd.Flags().GetString("value")
+		p.Func, _ = cmd.Flags().GetString("agg")
+		if _, err := internal.ParseAggregates([]string{p.Func + ":" + p.Value}); err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		err = m.ReshapeCSVFiles(files, dir, func(w *csv.Writer, file string) error {
+			return m.PivotFile(w, file, p)
+		})
+		if err != nil {
+			cmd.PrintErrln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pivotCmd)
+
+	pivotCmd.Flags().StringSliceP("rows", "r", nil, "Columns identifying an output row")
+	pivotCmd.Flags().StringP("column", "k", "", "Column whose values become output columns")
+	pivotCmd.Flags().StringP("value", "v", "", "Column aggregated into each cell")
+	pivotCmd.Flags().StringP("agg", "a", "sum", "How values are combined: sum, count, min, max, mean or distinct")
+	pivotCmd.Flags().String("dir", internal.DefaultReshapeDir, "Directory the pivoted files are written to")
+	_ = pivotCmd.MarkFlagRequired("column")
+	_ = pivotCmd.MarkFlagRequired("value")
+	addPipelineFlags(pivotCmd)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// reconcileCmd represents the reconcile command
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile LEFT RIGHT",
+	Args:  cobra.ExactArgs(2),
+	Short: "Match the records of a ledger and a bank export",
+	Long: `Pass the two files to reconcile, e.g. a ledger and a bank export.
+
+A record of one file matches a record of the other when their amounts are
+equal and their dates at most --days apart. When several records qualify,
+the one with the most similar description wins, then the closest date. Each
+record is matched at most once.
+
+Three files are written to reconciled (or --dir): matched.csv pairs the
+matched records side by side with their description similarity and the days
+between them, unmatched_left.csv and unmatched_right.csv hold the records of
+either file left over. A summary is printed.
+
+--date, --amount and --description name the columns compared, NAME when
+named alike in both files or LEFT=RIGHT.
+`,
+	Example: "reconcile ledger.csv bank.csv --description Memo=Description\nreconcile ledger.csv bank.csv --days 5 --min-similarity 0.3 --negate Amount",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := Files(args)
+		if err != nil {
+			cmd.PrintErr(err)
+			return
+		}
+		if len(files) != 2 {
+			cmd.PrintErrln("reconcile needs exactly two CSV files")
+			return
+		}
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+
+		var r internal.Reconcile
+		r.Days, _ = cmd.Flags().GetInt("days")
+		r.MinSimilarity, _ = cmd.Flags().GetFloat64("min-similarity")
+		for _, c := range []struct {
+			flag        string
+			left, right *string
+		}{
+			{"date", &r.LeftDate, &r.RightDate},
+			{"amount", &r.LeftAmount, &r.RightAmount},
+			{"description", &r.LeftDescription, &r.RightDescription},
+		} {
+			s, _ := cmd.Flags().GetString(c.flag)
+			if len(s) == 0 {
+				continue
+			}
+			l, r := internal.ParseJoinKeys([]string{s})
+			*c.left, *c.right = l[0], r[0]
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		report, err := m.ReconcileCSVFiles(files[0], files[1], r, dir)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		cmd.Print(report)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+
+	reconcileCmd.Flags().Int("days", 3, "Days the dates of matching records may be apart")
+	reconcileCmd.Flags().String("date", "Date", "Date columns, NAME or LEFT=RIGHT")
+	reconcileCmd.Flags().String("amount", "Amount", "Amount columns, NAME or LEFT=RIGHT")
+	reconcileCmd.Flags().String("description", "Description", "Description columns, NAME or LEFT=RIGHT; empty to ignore descriptions")
+	reconcileCmd.Flags().Float64("min-similarity", 0, "Description similarity, 0 to 1, a match needs at least")
+	reconcileCmd.Flags().String("dir", internal.DefaultReconcileDir, "Directory for the output files")
+	addPipelineFlags(reconcileCmd)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// recurringCmd represents the recurring command
+var recurringCmd = &cobra.Command{
+	Use:   "recurring",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Find payments repeating weekly, monthly or annually",
+	Long: `Pass file paths or directories as arguments, as with csv.
+
+Payments whose descriptions name the same payee (ignoring case, digits and
+punctuation, so "NETFLIX.COM 8841" and "Netflix.com 9920" match) and whose
+amounts are within --tolerance of each other form a series. A series repeating
+weekly, monthly or annually is written to recurring.csv with its cadence,
+number of payments, average amount, first and last dates and the date the
+next payment is expected.
+
+Weekly and monthly series need at least --min-count payments, annual ones two.
+`,
+	Example: "recurring . --negate Amount\nrecurring card.csv --description Payee --date \"Transaction Date\"",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := Files(args)
+		if err != nil {
+			cmd.PrintErr(err)
+			return
+		}
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+
+		var r internal.Recurring
+		r.DateColumn, _ = cmd.Flags().GetString("date")
+		r.DescriptionColumn, _ = cmd.Flags().GetString("description")
+		r.AmountColumn, _ = cmd.Flags().GetString("amount")
+		r.MinCount, _ = cmd.Flags().GetInt("min-count")
+		r.Tolerance, _ = cmd.Flags().GetFloat64("tolerance")
+		if r.Tolerance < 0 {
+			cmd.PrintErrf("invalid --tolerance %v\n", r.Tolerance)
+			return
+		}
+		m.RecurringCSVFiles(files, r, outputFlag(cmd))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recurringCmd)
+
+	recurringCmd.Flags().String("date", "Date", "Column holding the payment date")
+	recurringCmd.Flags().String("description", "Description", "Column holding the payee")
+	recurringCmd.Flags().String("amount", "Amount", "Column holding the amount")
+	recurringCmd.Flags().Int("min-count", internal.DefaultRecurringMinCount, "Payments a weekly or monthly series needs at least")
+	recurringCmd.Flags().Float64("tolerance", internal.DefaultRecurringTolerance, "How far an amount may be from the series' median, as a fraction of it")
+	recurringCmd.Flags().StringP("output", "o", "", "Output file name (default "+internal.DefaultRecurringFile+")")
+	addPipelineFlags(recurringCmd)
+}
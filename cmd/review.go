@@ -0,0 +1,170 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// reviewCmd represents the review command
+var reviewCmd = &cobra.Command{
+	Use:   "review FILE",
+	Args:  cobra.ExactArgs(1),
+	Short: "Assign categories to uncategorized rows of a merged file",
+	Long: `Pass a merged file with a single header line, e.g. merged.csv written by
+csv -u --rules.
+
+Each row without a Category, or categorized by a rule whose Confidence is
+below --below, is shown in turn. Type a category to assign it, or:
+
+  RETURN  keep the row's current category (none for an uncategorized row)
+  s       skip the row
+  u       undo the last decision
+  q       quit; the review resumes where it stopped when run again
+
+With --rules, a category can be followed by a pattern; the rows containing
+it are categorized alike by a rule added to the rule file when the review
+is finished. The file is updated in place.
+`,
+	Example: "review merged.csv --rules rules.csv",
+	Run: func(cmd *cobra.Command, args []string) {
+		rulesFile, _ := cmd.Flags().GetString("rules")
+		c := internal.NewCategorizer()
+		if len(rulesFile) > 0 {
+			var err error
+			if c, err = internal.LoadRules(rulesFile); errors.Is(err, os.ErrNotExist) {
+				c = internal.NewCategorizer()
+				c.File = rulesFile
+			} else if err != nil {
+				cmd.PrintErrf("invalid --rules: %v\n", err)
+				return
+			}
+		}
+		below, _ := cmd.Flags().GetFloat64("below")
+		r, err := internal.NewReview(args[0], c, below)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		finished, err := review(bufio.NewScanner(cmd.InOrStdin()), cmd.OutOrStdout(), r)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		if !finished {
+			err = r.Apply()
+		} else {
+			err = r.Finish()
+		}
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		if !finished {
+			cmd.Printf("%s updated; run review again to continue\n", args[0])
+		} else {
+			cmd.Printf("%s updated; review finished\n", args[0])
+		}
+	},
+}
+
+// review asks for a decision on each pending row of r, saving the progress
+// after each one, and reports whether every row was decided.
+func review(in *bufio.Scanner, out io.Writer, r *internal.Review) (bool, error) {
+	items := r.Pending()
+	if len(items) == 0 {
+		fmt.Fprintln(out, "Nothing to review.")
+		return true, nil
+	}
+	fmt.Fprintf(out, "%d rows to review. Type a category, RETURN to keep, s to skip, u to undo, q to quit.\n", len(items))
+	undoable := 0 // decisions made in this session
+	for i := 0; i < len(items); {
+		it := items[i]
+		fmt.Fprintf(out, "\n[%d/%d] row %d: %s\n", i+1, len(items), it.Row, describeRow(r.Header, it.Record))
+		if it.Suggested != nil {
+			fmt.Fprintf(out, "  categorized %s by rule %s with confidence %v\n", it.Suggested.Category, it.Suggested, it.Suggested.Confidence)
+		}
+		answer, ok := prompt(in, out, "Category: ")
+		if !ok || answer == "q" {
+			return false, nil
+		}
+		d := internal.Decision{Row: it.Row, Category: r.Category(it)}
+		switch answer {
+		case "u":
+			if undoable == 0 {
+				fmt.Fprintln(out, "Nothing to undo.")
+				continue
+			}
+			r.Undo()
+			undoable--
+			i--
+			if err := r.SaveProgress(); err != nil {
+				return false, err
+			}
+			continue
+		case "s":
+			d.Category = ""
+		case "":
+		default:
+			d.Category = answer
+			if r.Categories.File != "" {
+				if d.Pattern, ok = prompt(in, out, "Rule pattern (RETURN for none): "); !ok {
+					return false, nil
+				}
+			}
+		}
+		r.Decide(d)
+		if err := r.SaveProgress(); err != nil {
+			return false, err
+		}
+		undoable++
+		i++
+	}
+	return true, nil
+}
+
+// describeRow returns the non-blank cells of a row with their column names.
+func describeRow(header, record []string) string {
+	var cells []string
+	for i, h := range header {
+		if i < len(record) && strings.TrimSpace(record[i]) != "" {
+			cells = append(cells, fmt.Sprintf("%s=%s", h, record[i]))
+		}
+	}
+	return strings.Join(cells, "  ")
+}
+
+func init() {
+	rootCmd.AddCommand(reviewCmd)
+
+	reviewCmd.Flags().String("rules", "", "Rule file suggesting categories and receiving new rules")
+	reviewCmd.Flags().Float64("below", internal.DefaultReviewBelow, "Review rows categorized by rules with a lower Confidence")
+}
@@ -0,0 +1,508 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+//go:embed ui.html
+var uiPage []byte
+
+// uiPreviewLines is the number of merged rows previewed by the web UI.
+const uiPreviewLines = 20
+
+// uiMaxUpload is the size of the files dropped in the web UI kept in memory
+// while they are saved.
+const uiMaxUpload = 32 << 20
+
+// uiCmd represents the ui command
+var uiCmd = &cobra.Command{
+	Use:   "ui [FILES|DIRS...]",
+	Short: "Build a config in the browser",
+	Long: `Starts a web page on this computer for building a config file without the
+terminal. Pass file paths or directories as arguments, as with csv, or drop
+CSV files onto the page.
+
+The page shows the columns of every file side by side. Click a column to add
+it to the output, then rename it, negate its values or pick the column each
+file reads it from, watching a preview of the merged rows. Save writes the
+config, to be used with csv -c.
+
+The server only listens on localhost and stops with Ctrl-C.
+`,
+	Example: "ui .\nui statements/ --addr localhost:9000 -o bank-cfg.csv",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := Files(args)
+		if err != nil {
+			cmd.PrintErr(err)
+			return
+		}
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+		addr, _ := cmd.Flags().GetString("addr")
+		if host, _, err := net.SplitHostPort(addr); err != nil {
+			cmd.PrintErrf("invalid --addr: %v\n", err)
+			return
+		} else if !isLoopback(host) {
+			cmd.PrintErrf("invalid --addr %s: the ui only listens on localhost\n", addr)
+			return
+		}
+		dir, err := os.MkdirTemp("", "merger-ui")
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		defer os.RemoveAll(dir)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+
+		b := &configBuilder{merger: m, dir: dir, files: files, out: cmd.OutOrStderr()}
+		b.config, _ = cmd.Flags().GetString("output")
+		srv := &http.Server{Handler: localOnly(b.handler())}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+		cmd.Printf("building %s at http://%s/ (Ctrl-C to stop)\n", b.config, ln.Addr())
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			cmd.PrintErrln(err)
+		}
+	},
+}
+
+// configBuilder serves the web UI: the files to merge, previews of the
+// columns picked, and the config saving them.
+type configBuilder struct {
+	merger *internal.Merger // as set by the pipeline flags; copied for each plan
+	dir    string           // where dropped files are kept
+	config string           // the config file written on save
+	out    io.Writer
+
+	// run is held while merger, or a copy, reads the files: the reports of
+	// the row pipeline are not safe for concurrent use.
+	run sync.Mutex
+
+	mu    sync.Mutex
+	files []string
+}
+
+// uiFile is an input file and its columns, as shown by the web UI.
+type uiFile struct {
+	Path    string                `json:"path"`
+	Name    string                `json:"name"`
+	Columns []internal.ColumnInfo `json:"columns"`
+}
+
+// uiPlan is the columns picked in the web UI, in output order.
+type uiPlan struct {
+	Columns []uiColumn `json:"columns"`
+}
+
+// uiColumn is a column picked in the web UI. Sources holds, by file path,
+// the column of the file read as this one when its name differs.
+type uiColumn struct {
+	Name    string            `json:"name"`
+	Rename  string            `json:"rename"`
+	Negate  bool              `json:"negate"`
+	Sources map[string]string `json:"sources"`
+}
+
+// uiPreview is the first merged rows of a plan, with the picked columns
+// files lack and the columns of those files that might stand for them.
+type uiPreview struct {
+	Header      []string       `json:"header"`
+	Rows        [][]string     `json:"rows"`
+	Missing     []uiMissing    `json:"missing"`
+	Suggestions []uiSuggestion `json:"suggestions"`
+}
+
+type uiMissing struct {
+	File    string   `json:"file"`
+	Columns []string `json:"columns"`
+}
+
+type uiSuggestion struct {
+	File   string  `json:"file"`
+	Column string  `json:"column"`
+	Source string  `json:"source"`
+	Score  float64 `json:"score"`
+}
+
+func (b *configBuilder) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", b.page)
+	mux.HandleFunc("/files", b.filesHandler)
+	mux.HandleFunc("/upload", b.upload)
+	mux.HandleFunc("/preview", b.preview)
+	mux.HandleFunc("/save", b.save)
+	return mux
+}
+
+func (b *configBuilder) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+// filesHandler lists the input files with their columns. A POST first adds
+// the files and directories in "add", as on the command line, and drops
+// those in "remove".
+func (b *configBuilder) filesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !jsonRequest(r) {
+			http.Error(w, "send files as application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		var req struct {
+			Add    []string `json:"add"`
+			Remove []string `json:"remove"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, a := range req.Add {
+			files, err := Files([]string{a})
+			if err == nil && len(files) == 0 {
+				err = fmt.Errorf("%s: no CSV files", a)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			b.add(files...)
+		}
+		b.remove(req.Remove...)
+	}
+	b.writeFiles(w)
+}
+
+// upload keeps the CSV files dropped in the web UI and adds them to the
+// input files.
+func (b *configBuilder) upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST files to upload", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(uiMaxUpload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, fh := range r.MultipartForm.File["file"] {
+		name := filepath.Base(fh.Filename)
+		if !strings.HasSuffix(strings.ToLower(name), ".csv") {
+			http.Error(w, fmt.Sprintf("%s is not a CSV file", name), http.StatusBadRequest)
+			return
+		}
+		dst, err := b.saveUpload(fh, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		b.add(dst)
+	}
+	b.writeFiles(w)
+}
+
+// saveUpload keeps a dropped file under its own name in a directory of its
+// own, so that files of the same name don't replace each other.
+func (b *configBuilder) saveUpload(fh *multipart.FileHeader, name string) (string, error) {
+	dir, err := os.MkdirTemp(b.dir, "upload")
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, name)
+	return dst, writeUpload(fh, dst)
+}
+
+func writeUpload(fh *multipart.FileHeader, dst string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// preview writes the first merged rows of the posted plan.
+func (b *configBuilder) preview(w http.ResponseWriter, r *http.Request) {
+	b.run.Lock()
+	defer b.run.Unlock()
+	m, cols, err := b.plan(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files := b.list()
+	m.Unified = true
+	var p uiPreview
+	reader := csv.NewReader(strings.NewReader(m.Preview(files, cols, uiPreviewLines+1)))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(rows) > 0 {
+		p.Header, p.Rows = rows[0], rows[1:]
+	}
+	for _, c := range m.Coverage(files, cols, nil) {
+		if len(c.Missing) > 0 {
+			p.Missing = append(p.Missing, uiMissing{File: c.File, Columns: c.Missing})
+		}
+	}
+	// nothing is taken without the user picking it
+	for _, c := range m.MatchColumns(files, cols, internal.FuzzyMatch{Threshold: 2}) {
+		p.Suggestions = append(p.Suggestions, uiSuggestion{File: c.File, Column: c.Column, Source: c.Source, Score: c.Score})
+	}
+	writeJSON(w, p)
+}
+
+// save writes the posted plan to the config file.
+func (b *configBuilder) save(w http.ResponseWriter, r *http.Request) {
+	b.run.Lock()
+	defer b.run.Unlock()
+	m, cols, err := b.plan(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := internal.SaveConfig(b.config, m.Config(cols)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(b.out, "generated %s\n", b.config)
+	writeJSON(w, map[string]string{"saved": b.config})
+}
+
+// plan reads the plan posted in r: a copy of the pipeline's Merger renaming,
+// negating and reading the columns picked as asked, and those columns.
+func (b *configBuilder) plan(r *http.Request) (*internal.Merger, []string, error) {
+	if r.Method != http.MethodPost || !jsonRequest(r) {
+		return nil, nil, fmt.Errorf("POST a plan as application/json")
+	}
+	var p uiPlan
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, nil, err
+	}
+	if len(b.list()) == 0 {
+		return nil, nil, fmt.Errorf("add some files first")
+	}
+	m := *b.merger
+	m.Rename = make(map[string]string)
+	m.NegateColumns = append([]string{}, b.merger.NegateColumns...)
+	m.Aliases = nil
+	var cols []string
+	for _, c := range p.Columns {
+		name := strings.TrimSpace(c.Name)
+		switch {
+		case name == "":
+			return nil, nil, fmt.Errorf("a column has no name")
+		case contains(cols, name):
+			return nil, nil, fmt.Errorf("%s is picked twice", name)
+		}
+		cols = append(cols, name)
+		if to := strings.TrimSpace(c.Rename); to != "" && to != name {
+			m.Rename[name] = to
+		}
+		if c.Negate {
+			m.NegateColumns = append(m.NegateColumns, name)
+		}
+		for _, f := range b.list() {
+			src := c.Sources[f]
+			if src == "" || internal.NormalizeHeader(src) == internal.NormalizeHeader(name) {
+				continue
+			}
+			if m.Aliases == nil {
+				m.Aliases = make(map[string][]string)
+			}
+			if !contains(m.Aliases[name], src) {
+				m.Aliases[name] = append(m.Aliases[name], src)
+			}
+		}
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("pick some columns first")
+	}
+	return &m, cols, nil
+}
+
+func (b *configBuilder) list() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.files...)
+}
+
+func (b *configBuilder) add(files ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, f := range files {
+		if !contains(b.files, f) {
+			b.files = append(b.files, f)
+		}
+	}
+}
+
+func (b *configBuilder) remove(files ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var kept []string
+	for _, f := range b.files {
+		if !contains(files, f) {
+			kept = append(kept, f)
+		}
+	}
+	b.files = kept
+}
+
+// writeFiles writes the input files with their columns, dropped files by
+// their own name, and the columns the row pipeline adds.
+func (b *configBuilder) writeFiles(w http.ResponseWriter) {
+	b.run.Lock()
+	defer b.run.Unlock()
+	files := b.list()
+	resp := struct {
+		Files   []uiFile `json:"files"`
+		Derived []string `json:"derived"`
+	}{Files: []uiFile{}, Derived: b.merger.DerivedColumns()}
+	for i, cols := range b.merger.Describe(files) {
+		f := uiFile{Path: files[i], Name: files[i], Columns: cols}
+		if filepath.Dir(filepath.Dir(f.Path)) == b.dir {
+			f.Name = filepath.Base(f.Path)
+		}
+		resp.Files = append(resp.Files, f)
+	}
+	writeJSON(w, resp)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// localOnly refuses requests addressed to a host other than this computer,
+// so that web pages cannot reach the server by pointing their own names at
+// it, and changes asked for by pages of other sites.
+func localOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if !isLoopback(host) {
+			http.Error(w, "the ui only answers on localhost", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+			http.Error(w, "the ui only answers its own page", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin reports whether r comes from the ui's own page. Browsers name
+// the site a request comes from in Origin and Sec-Fetch-Site; other clients
+// send neither.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+	return true
+}
+
+// jsonRequest reports whether the body of r is JSON. Pages of other sites
+// cannot post JSON without the browser asking the ui first, which it does
+// not answer.
+func jsonRequest(r *http.Request) bool {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && t == "application/json"
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+
+	uiCmd.Flags().String("addr", "localhost:8080", "Address to listen on, on this computer")
+	uiCmd.Flags().StringP("output", "o", internal.OutputConfigFileName, "Config file written on save")
+	addPipelineFlags(uiCmd)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2023 Paul Giles <pgilescapone@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/csv"
+
+	"github.com/pgiles/merger/internal"
+	"github.com/spf13/cobra"
+)
+
+// unpivotCmd represents the unpivot command
+var unpivotCmd = &cobra.Command{
+	Use:     "unpivot",
+	Aliases: []string{"melt"},
+	Args:    cobra.MinimumNArgs(1),
+	Short:   "Turn columns into name/value rows (wide to long)",
+	Long: `Pass file paths or directories as arguments, as with csv.
+
+Each file is melted on its own and written under the same name to the
+reshaped directory (or --dir), ready to be merged with csv. Every --columns
+column of a row becomes a row of its own holding the --id columns, the
+column's name and its value. Without --columns every column that isn't an
+--id column is melted; without --id every column that isn't melted is kept.
+`,
+	Example: "unpivot . --id Category --columns Jan,Feb,Mar --name Month --value Amount\nunpivot budget.csv --id Category",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := Files(args)
+		if err != nil {
+			cmd.PrintErr(err)
+			return
+		}
+		m := pipelineMerger(cmd)
+		if m == nil {
+			return
+		}
+
+		var u internal.Unpivot
+		u.ID, _ = cmd.Flags().GetStringSlice("id")
+		u.Columns, _ = cmd.Flags().GetStringSlice("columns")
+		u.NameColumn, _ = cmd.Flags().GetString("name")
+		u.ValueColumn, _ = cmd.Flags().GetString("value")
+		if len(u.ID) == 0 && len(u.Columns) == 0 {
+			cmd.PrintErrln("pass --id, --columns or both")
+			return
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		err = m.ReshapeCSVFiles(files, dir, func(w *csv.Writer, file string) error {
+			return m.UnpivotFile(w, file, u)
+		})
+		if err != nil {
+			cmd.PrintErrln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unpivotCmd)
+
+	unpivotCmd.Flags().StringSlice("id", nil, "Columns repeated on every output row")
+	unpivotCmd.Flags().StringSlice("columns", nil, "Columns turned into rows")
+	unpivotCmd.Flags().String("name", "Name", "Output column holding the melted column's name")
+	unpivotCmd.Flags().String("value", "Value", "Output column holding the melted column's value")
+	unpivotCmd.Flags().String("dir", internal.DefaultReshapeDir, "Directory the melted files are written to")
+	addPipelineFlags(unpivotCmd)
+}
@@ -6,6 +6,7 @@ require (
 	github.com/approvals/go-approval-tests v1.6.2
 	github.com/spf13/cobra v1.10.2
 	golang.org/x/exp v0.0.0-20230206171751-46f607a40771
+	golang.org/x/text v0.14.0
 )
 
 require (
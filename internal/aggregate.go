@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const DefaultAggregateFile = "aggregated.csv"
+
+// aggregateFuncs are the functions accepted by ParseAggregates.
+var aggregateFuncs = []string{"sum", "count", "min", "max", "mean", "distinct"}
+
+// Aggregate is a summary computed over the rows of each group, e.g. the sum
+// of Amount. Column may be empty for count, which then counts rows.
+type Aggregate struct {
+	Func   string
+	Column string
+}
+
+// ParseAggregates reads aggregates written as FUNC:COLUMN, e.g. sum:Amount,
+// or just count.
+func ParseAggregates(spec []string) ([]Aggregate, error) {
+	var aggs []Aggregate
+	for _, s := range spec {
+		fn, col, _ := strings.Cut(strings.TrimSpace(s), ":")
+		a := Aggregate{Func: strings.ToLower(fn), Column: col}
+		known := false
+		for _, f := range aggregateFuncs {
+			known = known || f == a.Func
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown aggregate %q in %q, use one of %s", fn, s, strings.Join(aggregateFuncs, ", "))
+		}
+		if col == "" && a.Func != "count" {
+			return nil, fmt.Errorf("%s needs a column, e.g. %s:Amount", a.Func, a.Func)
+		}
+		aggs = append(aggs, a)
+	}
+	return aggs, nil
+}
+
+// Header returns the name of the output column holding the aggregate.
+func (a Aggregate) Header() string {
+	if a.Column == "" {
+		return a.Func
+	}
+	return fmt.Sprintf("%s(%s)", a.Func, a.Column)
+}
+
+// accumulator holds the running state of one aggregate for one group.
+type accumulator struct {
+	count    int
+	sum      float64
+	scale    int
+	min, max string
+	distinct map[string]bool
+}
+
+func (acc *accumulator) add(fn string, value string) {
+	if fn == "count" && value == "" {
+		return
+	}
+	switch fn {
+	case "sum", "mean":
+		n, ok := ParseNumber(value)
+		if !ok {
+			return
+		}
+		acc.sum += n
+		if p := DecimalPlaces(value); p > acc.scale {
+			acc.scale = p
+		}
+	case "min", "max":
+		if value == "" {
+			return
+		}
+		if acc.count == 0 || CompareCells(value, acc.min) < 0 {
+			acc.min = value
+		}
+		if acc.count == 0 || CompareCells(value, acc.max) > 0 {
+			acc.max = value
+		}
+	case "distinct":
+		if value == "" {
+			return
+		}
+		if acc.distinct == nil {
+			acc.distinct = make(map[string]bool)
+		}
+		acc.distinct[value] = true
+	}
+	acc.count++
+}
+
+func (acc *accumulator) result(fn string) string {
+	switch fn {
+	case "count":
+		return fmt.Sprint(acc.count)
+	case "sum":
+		return FormatNumber(roundTo(acc.sum, acc.scale), acc.scale)
+	case "mean":
+		if acc.count == 0 {
+			return ""
+		}
+		return FormatNumber(roundTo(acc.sum/float64(acc.count), acc.scale+2), -1)
+	case "min":
+		return acc.min
+	case "max":
+		return acc.max
+	}
+	return fmt.Sprint(len(acc.distinct))
+}
+
+// AggregateCSVFiles groups the rows of files by the groupBy columns and
+// writes one row per group with the aggregates computed over its rows.
+func (m *Merger) AggregateCSVFiles(files []string, groupBy []string, aggs []Aggregate, outputFilename *string) {
+	if outputFilename == nil {
+		name := DefaultAggregateFile
+		outputFilename = &name
+	}
+	f := m.outputFile(outputFilename)
+	defer closeFile(f)
+
+	cw := csv.NewWriter(f)
+	m.aggregate(cw, files, groupBy, aggs)
+	fmt.Printf("%v <- %s\n", m.OutputFileName, strings.Join(files, ", "))
+}
+
+func (m *Merger) aggregate(w *csv.Writer, files []string, groupBy []string, aggs []Aggregate) {
+	columns := append([]string{}, groupBy...)
+	aggCols := make([]int, len(aggs))
+	for i, a := range aggs {
+		aggCols[i] = -1
+		if a.Column != "" {
+			aggCols[i] = len(columns)
+			columns = append(columns, a.Column)
+		}
+	}
+
+	type group struct {
+		key  []string
+		accs []accumulator
+	}
+	groups := make(map[string]*group)
+	var order []*group
+	m.eachRow(files, columns, func(_ int, row []string) {
+		k := strings.Join(row[:len(groupBy)], "\x1f")
+		g, ok := groups[k]
+		if !ok {
+			g = &group{key: row[:len(groupBy)], accs: make([]accumulator, len(aggs))}
+			groups[k] = g
+			order = append(order, g)
+		}
+		for i, a := range aggs {
+			value := "*" // count without a column counts rows
+			if aggCols[i] >= 0 {
+				value = row[aggCols[i]]
+			}
+			g.accs[i].add(a.Func, value)
+		}
+	})
+
+	kinds := make([]valueKind, len(groupBy))
+	for k := range groupBy {
+		values := make([]string, len(order))
+		for i, g := range order {
+			values[i] = g.key[k]
+		}
+		kinds[k] = kindOf(values)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		for k := range groupBy {
+			if c := kinds[k].compare(order[i].key[k], order[j].key[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	header := append([]string{}, groupBy...)
+	for _, a := range aggs {
+		header = append(header, a.Header())
+	}
+	writeLine(w, header)
+	for _, g := range order {
+		row := append([]string{}, g.key...)
+		for i, a := range aggs {
+			row = append(row, g.accs[i].result(a.Func))
+		}
+		writeLine(w, row)
+	}
+	w.Flush()
+}
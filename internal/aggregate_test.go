@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	month, _ := ParseComputed("Month = substr(Date, 0, 7)")
+	m := &Merger{Computed: []Computed{month}}
+	files := []string{"../cmd/fixtures/statement_jan.csv", "../cmd/fixtures/statement_feb.csv"}
+	aggs, err := ParseAggregates([]string{"sum:Amount", "count", "min:Date", "max:Amount", "mean:Amount", "distinct:Description"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bytes.NewBufferString("")
+	m.aggregate(csv.NewWriter(w), files, []string{"Month"}, aggs)
+
+	expected := `Month,sum(Amount),count,min(Date),max(Amount),mean(Amount),distinct(Description)
+2024-01,3995.50,3,2024-01-30,2000.00,1331.8333,2
+2024-02,-2404.50,3,2024-02-01,-4.50,-801.5,2
+`
+	if w.String() != expected {
+		t.Errorf("TestAggregate got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+}
+
+func TestParseAggregates(t *testing.T) {
+	for _, spec := range []string{"total:Amount", "sum", "mean:"} {
+		if _, err := ParseAggregates([]string{spec}); err == nil {
+			t.Errorf("ParseAggregates(%q) should fail", spec)
+		}
+	}
+}
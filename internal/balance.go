@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// RunningBalanceColumn and BalanceDiffColumn are the columns added to the
+// output of a combine computing running balances.
+const (
+	RunningBalanceColumn = "RunningBalance"
+	BalanceDiffColumn    = "BalanceDiff"
+)
+
+// RunningBalance configures the cumulative total of an amount column written
+// next to each row of a unified combine, in output (i.e. sorted) order.
+type RunningBalance struct {
+	AmountColumn string
+	// Opening is the balance before the first row; when nil it is zero, or
+	// when Check is set, inferred from the first row's stated balance.
+	Opening *float64
+	// ByFile keeps a separate balance for each input file and By, when set,
+	// for each value of that column, e.g. an account number.
+	ByFile bool
+	By     string
+	// Check names a column holding the balance stated by the bank; rows
+	// where it differs from the computed balance get the difference in the
+	// BalanceDiff column.
+	Check string
+}
+
+// Columns returns the names of the columns added to each row.
+func (r RunningBalance) Columns() []string {
+	if r.Check != "" {
+		return []string{RunningBalanceColumn, BalanceDiffColumn}
+	}
+	return []string{RunningBalanceColumn}
+}
+
+// balancer computes the running balances of the rows written by combine.
+type balancer struct {
+	opts                 RunningBalance
+	amount, group, check int // positions in the output header, -1 if unused
+	totals               map[string]float64
+	scale                int
+	rows, mismatches     int
+}
+
+// newBalancer returns a balancer for rows aligned to header, or an error
+// naming a column header lacks.
+func newBalancer(header []string, opts RunningBalance) (*balancer, error) {
+	b := &balancer{opts: opts, group: -1, check: -1, totals: make(map[string]float64)}
+	index := headerIndex(header)
+	var ok bool
+	if b.amount, ok = index[opts.AmountColumn]; !ok {
+		return nil, fmt.Errorf("running balance: column %q not found in %v", opts.AmountColumn, header)
+	}
+	for _, c := range []struct {
+		name string
+		dst  *int
+	}{{opts.By, &b.group}, {opts.Check, &b.check}} {
+		if c.name == "" {
+			continue
+		}
+		if *c.dst, ok = index[c.name]; !ok {
+			return nil, fmt.Errorf("running balance: column %q not found in %v", c.name, header)
+		}
+	}
+	return b, nil
+}
+
+// CheckBalanceColumns returns an error when header lacks a column needed to
+// compute running balances.
+func CheckBalanceColumns(header []string, opts RunningBalance) error {
+	_, err := newBalancer(header, opts)
+	return err
+}
+
+// apply returns row, read from the input file at position file, followed by
+// its running balance and, when checking, the difference from the stated
+// balance.
+func (b *balancer) apply(row []string, file int) []string {
+	key := ""
+	if b.opts.ByFile {
+		key = strconv.Itoa(file)
+	}
+	if b.group >= 0 {
+		key += "\x1f" + row[b.group]
+	}
+	amount, ok := ParseNumber(row[b.amount])
+	if !ok {
+		amount = 0
+	}
+	if p := DecimalPlaces(row[b.amount]); p > b.scale {
+		b.scale = p
+	}
+	stated, hasStated := 0.0, false
+	if b.check >= 0 {
+		stated, hasStated = ParseNumber(row[b.check])
+	}
+
+	total, started := b.totals[key]
+	if !started {
+		switch {
+		case b.opts.Opening != nil:
+			total = *b.opts.Opening
+		case hasStated:
+			total = stated - amount
+		}
+	}
+	total += amount
+	b.totals[key] = total
+	b.rows++
+
+	out := append(row, FormatNumber(roundTo(total, b.scale), b.scale))
+	if b.check < 0 {
+		return out
+	}
+	diff := ""
+	if hasStated && math.Abs(stated-total) >= 0.005 {
+		diff = FormatNumber(roundTo(stated-total, b.scale), b.scale)
+		b.mismatches++
+	}
+	return append(out, diff)
+}
+
+func (b *balancer) report() string {
+	if b.check < 0 {
+		return ""
+	}
+	if b.mismatches == 0 {
+		return fmt.Sprintf("balance: all %d rows agree with %s\n", b.rows, b.opts.Check)
+	}
+	return fmt.Sprintf("balance: %d of %d rows disagree with %s, see %s\n", b.mismatches, b.rows, b.opts.Check, BalanceDiffColumn)
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCombineRunningBalance(t *testing.T) {
+	opening := 1000.0
+	var tests = []struct {
+		name     string
+		files    []string
+		opts     RunningBalance
+		dedupe   bool
+		expected string
+	}{
+		{"check", []string{"../cmd/fixtures/statement_jan.csv", "../cmd/fixtures/statement_feb.csv"}, RunningBalance{Check: "Balance"}, true, `Date,Description,Amount,Balance,RunningBalance,BalanceDiff
+2024-01-30,Coffee,-4.50,995.50,995.50,
+2024-01-31,Payroll,2000.00,2995.50,2995.50,
+2024-02-01,Rent,-1200.00,1795.50,1795.50,
+2024-02-02,Coffee,-4.50,1791.00,1791.00,
+`},
+		{"check duplicates", []string{"../cmd/fixtures/statement_jan.csv", "../cmd/fixtures/statement_feb.csv"}, RunningBalance{Check: "Balance"}, false, `Date,Description,Amount,Balance,RunningBalance,BalanceDiff
+2024-01-30,Coffee,-4.50,995.50,995.50,
+2024-01-31,Payroll,2000.00,2995.50,2995.50,
+2024-01-31,Payroll,2000.00,2995.50,4995.50,-2000.00
+2024-02-01,Rent,-1200.00,1795.50,3795.50,-2000.00
+2024-02-01,Rent,-1200.00,1795.50,2595.50,-800.00
+2024-02-02,Coffee,-4.50,1791.00,2591.00,-800.00
+`},
+		{"by file", []string{"../cmd/fixtures/checking.csv", "../cmd/fixtures/card.csv"}, RunningBalance{ByFile: true, Opening: &opening}, false, `Date,Description,Amount,RunningBalance
+2024-03-01,Payroll,2500.00,3500.00
+2024-03-02,Books,-45.00,955.00
+2024-03-05,Card payment,-500.00,3000.00
+2024-03-06,Groceries,-80.00,2920.00
+2024-03-07,Payment thank you,500.00,1455.00
+2024-03-10,Refund,80.00,1535.00
+2024-03-20,Transfer to savings,-500.00,2420.00
+`},
+		{"total", []string{"../cmd/fixtures/checking.csv", "../cmd/fixtures/card.csv"}, RunningBalance{}, false, `Date,Description,Amount,RunningBalance
+2024-03-01,Payroll,2500.00,2500.00
+2024-03-02,Books,-45.00,2455.00
+2024-03-05,Card payment,-500.00,1955.00
+2024-03-06,Groceries,-80.00,1875.00
+2024-03-07,Payment thank you,500.00,2375.00
+2024-03-10,Refund,80.00,2455.00
+2024-03-20,Transfer to savings,-500.00,1955.00
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.AmountColumn = "Amount"
+			// sort in chunks of two to take the rows through temp files
+			m := &Merger{Balance: &tt.opts, Sort: []SortKey{{Column: "Date"}}, SortChunkRows: 2}
+			if tt.dedupe {
+				m.Dedupe = &Dedupe{}
+			}
+			w := bytes.NewBufferString("")
+			m.combine(csv.NewWriter(w), tt.files, nil)
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckBalanceColumns(t *testing.T) {
+	header := []string{"Date", "Amount", "Balance"}
+	var tests = []struct {
+		opts RunningBalance
+		ok   bool
+	}{
+		{RunningBalance{AmountColumn: "Amount", Check: "Balance"}, true},
+		{RunningBalance{AmountColumn: "Total"}, false},
+		{RunningBalance{AmountColumn: "Amount", By: "Account"}, false},
+		{RunningBalance{AmountColumn: "Amount", Check: "Stated"}, false},
+	}
+	for _, tt := range tests {
+		if err := CheckBalanceColumns(header, tt.opts); (err == nil) != tt.ok {
+			t.Errorf("CheckBalanceColumns(%+v) = %v", tt.opts, err)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RuleMatches are the ways a rule's Pattern can match a column.
+var RuleMatches = []string{"contains", "prefix", "equals", "regex"}
+
+// ruleFileHeader is the header of a rule file; every column but Category is
+// optional.
+var ruleFileHeader = []string{"Column", "Match", "Pattern", "Min", "Max", "When", "Category", "Tags", "Confidence"}
+
+// Rule assigns a Category and Tags to the rows it matches. A row matches
+// when every condition given holds: Pattern matches one of Columns (using
+// Match, ignoring case except for regex), the amount lies within [Min, Max]
+// and the When expression is true. Confidence, between 0 and 1, says how
+// sure the rule's author is of it; rows categorized by rules below a
+// threshold are shown again by a review.
+type Rule struct {
+	Columns    []string
+	Match      string
+	Pattern    string
+	Min, Max   *float64
+	When       *Expr
+	Category   string
+	Tags       string
+	Confidence float64
+
+	line int
+	re   *regexp.Regexp
+	hits int
+}
+
+// Categorizer applies an ordered list of rules to rows; the first matching
+// rule wins. Rows that already have a category are left alone unless
+// Override is set.
+type Categorizer struct {
+	File     string
+	Rules    []*Rule
+	Override bool
+	// Header is the header of the rule file, used when rules are added to it.
+	Header []string
+	// CategoryColumn, TagsColumn and AmountColumn name the columns written
+	// and read; TextColumns are the columns patterns are matched against
+	// when a rule names none.
+	CategoryColumn string
+	TagsColumn     string
+	AmountColumn   string
+	TextColumns    []string
+
+	rows          int
+	uncategorized map[string]int
+}
+
+// NewCategorizer returns a Categorizer with the default column names and no
+// rules.
+func NewCategorizer() *Categorizer {
+	return &Categorizer{
+		CategoryColumn: "Category",
+		TagsColumn:     "Tags",
+		AmountColumn:   "Amount",
+		TextColumns:    []string{"Description", "Memo"},
+		Header:         ruleFileHeader,
+		uncategorized:  make(map[string]int),
+	}
+}
+
+// LoadRules reads a rule file: a CSV file with a header naming some of the
+// columns Column, Match, Pattern, Min, Max, When, Category, Tags and
+// Confidence.
+// Multiple columns to match are separated by "|", e.g. Description|Memo.
+func LoadRules(file string) (*Categorizer, error) {
+	c := NewCategorizer()
+	c.File = file
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(f)
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	c.Header = records[0]
+	index := headerIndex(records[0])
+	for _, h := range records[0] {
+		known := false
+		for _, k := range ruleFileHeader {
+			known = known || k == h
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: unknown column %q, use %s", file, h, strings.Join(ruleFileHeader, ","))
+		}
+	}
+	if _, ok := index["Category"]; !ok {
+		return nil, fmt.Errorf("%s: missing the Category column", file)
+	}
+	for n, rec := range records[1:] {
+		get := func(col string) string {
+			if i, ok := index[col]; ok {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		r, err := NewRule(get)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", file, n+2, err)
+		}
+		r.line = n + 2
+		c.Rules = append(c.Rules, r)
+	}
+	return c, nil
+}
+
+// NewRule builds a rule from the values of a rule file row.
+func NewRule(get func(column string) string) (*Rule, error) {
+	r := &Rule{Match: strings.ToLower(get("Match")), Pattern: get("Pattern"), Category: get("Category"), Tags: get("Tags"), Confidence: 1}
+	if r.Match == "" {
+		r.Match = "contains"
+	}
+	known := false
+	for _, m := range RuleMatches {
+		known = known || m == r.Match
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown Match %q, use one of %s", r.Match, strings.Join(RuleMatches, ", "))
+	}
+	if col := get("Column"); col != "" {
+		r.Columns = strings.Split(col, "|")
+	}
+	var err error
+	if r.Match == "regex" && r.Pattern != "" {
+		if r.re, err = regexp.Compile(r.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	for _, bound := range []struct {
+		col string
+		dst **float64
+	}{{"Min", &r.Min}, {"Max", &r.Max}} {
+		if s := get(bound.col); s != "" {
+			n, ok := ParseNumber(s)
+			if !ok {
+				return nil, fmt.Errorf("%s %q is not a number", bound.col, s)
+			}
+			*bound.dst = &n
+		}
+	}
+	if s := get("When"); s != "" {
+		if r.When, err = ParseExpr(s); err != nil {
+			return nil, err
+		}
+	}
+	if s := get("Confidence"); s != "" {
+		n, ok := ParseNumber(s)
+		if !ok || n < 0 || n > 1 {
+			return nil, fmt.Errorf("Confidence %q is not a number between 0 and 1", s)
+		}
+		r.Confidence = n
+	}
+	if r.Category == "" {
+		return nil, fmt.Errorf("missing Category")
+	}
+	return r, nil
+}
+
+// Record returns the rule as a row of a rule file with the given header.
+func (r *Rule) Record(header []string) []string {
+	values := map[string]string{
+		"Column":   strings.Join(r.Columns, "|"),
+		"Match":    r.Match,
+		"Pattern":  r.Pattern,
+		"Category": r.Category,
+		"Tags":     r.Tags,
+	}
+	if r.Min != nil {
+		values["Min"] = FormatNumber(*r.Min, -1)
+	}
+	if r.Max != nil {
+		values["Max"] = FormatNumber(*r.Max, -1)
+	}
+	if r.When != nil {
+		values["When"] = r.When.String()
+	}
+	if r.Confidence != 1 {
+		values["Confidence"] = FormatNumber(r.Confidence, -1)
+	}
+	rec := make([]string, len(header))
+	for i, h := range header {
+		rec[i] = values[h]
+	}
+	return rec
+}
+
+func (r *Rule) String() string {
+	if r.line > 0 {
+		return fmt.Sprintf("line %d (%s)", r.line, r.Category)
+	}
+	return r.Category
+}
+
+// matches reports whether the rule applies to a row.
+func (r *Rule) matches(c *Categorizer, get func(string) string) bool {
+	if r.Pattern != "" {
+		cols := r.Columns
+		if cols == nil {
+			cols = c.TextColumns
+		}
+		found := false
+		for _, col := range cols {
+			if found = r.matchText(get(col)); found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Min != nil || r.Max != nil {
+		n, ok := ParseNumber(get(c.AmountColumn))
+		if !ok || r.Min != nil && n < *r.Min || r.Max != nil && n > *r.Max {
+			return false
+		}
+	}
+	return r.When == nil || r.When.Match(get)
+}
+
+func (r *Rule) matchText(s string) bool {
+	if r.re != nil {
+		return r.re.MatchString(s)
+	}
+	s, p := strings.ToLower(strings.TrimSpace(s)), strings.ToLower(r.Pattern)
+	switch r.Match {
+	case "prefix":
+		return strings.HasPrefix(s, p)
+	case "equals":
+		return s == p
+	}
+	return strings.Contains(s, p)
+}
+
+// SaveRules appends rules to the rule file, creating it if need be, and to
+// Rules.
+func (c *Categorizer) SaveRules(rules []*Rule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	if c.File == "" {
+		return fmt.Errorf("no rule file to add rules to")
+	}
+	f, err := os.OpenFile(c.File, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer closeFile(f)
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if end == 0 {
+		writeLine(w, c.Header)
+	} else {
+		// a hand-written file may lack the final line break
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, end-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			if _, err := f.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+	}
+	for _, r := range rules {
+		writeLine(w, r.Record(c.Header))
+		c.Rules = append(c.Rules, r)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Columns returns the names of the columns the categorizer writes.
+func (c *Categorizer) Columns() []string {
+	return []string{c.CategoryColumn, c.TagsColumn}
+}
+
+// Find returns the first rule matching a row, if any.
+func (c *Categorizer) Find(get func(string) string) *Rule {
+	for _, r := range c.Rules {
+		if r.matches(c, get) {
+			return r
+		}
+	}
+	return nil
+}
+
+// categorized is how apply categorized a row, counted in the report by count
+// once the row is written.
+type categorized struct {
+	rule          *Rule
+	uncategorized string // the text describing a row left without a category
+}
+
+// apply categorizes row, whose columns are positioned by index.
+func (c *Categorizer) apply(index map[string]int, row []string) categorized {
+	get := rowGetter(index, row)
+	if !c.Override && strings.TrimSpace(get(c.CategoryColumn)) != "" {
+		return categorized{}
+	}
+	r := c.Find(get)
+	if r == nil {
+		if strings.TrimSpace(get(c.CategoryColumn)) == "" {
+			return categorized{uncategorized: c.describe(get)}
+		}
+		return categorized{}
+	}
+	row[index[c.CategoryColumn]] = r.Category
+	if r.Tags != "" || c.Override {
+		row[index[c.TagsColumn]] = r.Tags
+	}
+	return categorized{rule: r}
+}
+
+// count adds a row written to the output to the report.
+func (c *Categorizer) count(o categorized) {
+	c.rows++
+	switch {
+	case o.rule != nil:
+		o.rule.hits++
+	case o.uncategorized != "":
+		c.uncategorized[o.uncategorized]++
+	}
+}
+
+// describe returns the text a row is best recognised by in the report.
+func (c *Categorizer) describe(get func(string) string) string {
+	for _, col := range c.TextColumns {
+		if s := strings.TrimSpace(get(col)); s != "" {
+			return s
+		}
+	}
+	return "(blank)"
+}
+
+// resetStats forgets the rows seen so far, for pipelines reading the input
+// more than once.
+func (c *Categorizer) resetStats() {
+	c.rows = 0
+	c.uncategorized = make(map[string]int)
+	for _, r := range c.Rules {
+		r.hits = 0
+	}
+}
+
+// Report summarises the rule hits and the rows left without a category,
+// most frequent first.
+func (c *Categorizer) Report() string {
+	var sb strings.Builder
+	total := 0
+	for _, n := range c.uncategorized {
+		total += n
+	}
+	fmt.Fprintf(&sb, "categories: %d of %d rows uncategorized\n", total, c.rows)
+	for _, r := range c.Rules {
+		fmt.Fprintf(&sb, "  %6d  rule %s\n", r.hits, r)
+	}
+	texts := make([]string, 0, len(c.uncategorized))
+	for s := range c.uncategorized {
+		texts = append(texts, s)
+	}
+	sort.Slice(texts, func(i, j int) bool {
+		a, b := c.uncategorized[texts[i]], c.uncategorized[texts[j]]
+		return a > b || a == b && texts[i] < texts[j]
+	})
+	for _, s := range texts {
+		fmt.Fprintf(&sb, "  %6d  uncategorized %s\n", c.uncategorized[s], s)
+	}
+	return sb.String()
+}
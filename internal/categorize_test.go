@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCategorizerFind(t *testing.T) {
+	c, err := LoadRules("../cmd/fixtures/rules.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		description string
+		amount      string
+		want        string
+	}{
+		{"Payroll ACME", "2000.00", "Income"},
+		{"Payroll reversal", "-2000.00", "Large"},
+		{"rent", "-1200.00", "Large"},
+		{"Rent", "-1200.00", "Housing"},
+		{"Coffee Shop", "-4.50", "Dining"},
+		{"COFFEE beans", "-25.00", ""},
+		{"Groceries", "-50.00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description+"|"+tt.amount, func(t *testing.T) {
+			row := map[string]string{"Description": tt.description, "Amount": tt.amount}
+			got := ""
+			if r := c.Find(func(col string) string { return row[col] }); r != nil {
+				got = r.Category
+			}
+			if got != tt.want {
+				t.Errorf("Find(%q, %s) = %q, want %q", tt.description, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRulesError(t *testing.T) {
+	for _, file := range []string{
+		"../cmd/fixtures/missing.csv",
+		"../cmd/fixtures/merchants.csv",
+		"../cmd/fixtures/statement_jan.csv",
+	} {
+		if _, err := LoadRules(file); err == nil {
+			t.Errorf("LoadRules(%q) should fail", file)
+		}
+	}
+	for _, row := range []map[string]string{
+		{"Match": "fuzzy", "Category": "X"},
+		{"Match": "regex", "Pattern": "(", "Category": "X"},
+		{"Min": "ten", "Category": "X"},
+		{"When": "Amount >", "Category": "X"},
+		{"Pattern": "coffee"},
+	} {
+		if _, err := NewRule(func(col string) string { return row[col] }); err == nil {
+			t.Errorf("NewRule(%v) should fail", row)
+		}
+	}
+}
+
+func TestCombineCategories(t *testing.T) {
+	var tests = []struct {
+		name     string
+		override bool
+		lookup   bool
+		where    string
+		expected string
+		report   string
+	}{
+		{"fill", false, false, "", `Description,Amount,Category,Tags
+Coffee,-4.50,Dining,daily
+Payroll,2000.00,Income,salary
+Rent,-1200.00,Housing,fixed
+`, `categories: 0 of 3 rows uncategorized
+       1  rule line 2 (Income)
+       1  rule line 3 (Housing)
+       1  rule line 4 (Dining)
+       0  rule line 5 (Large)
+`},
+		{"keep lookup", false, true, "", `Description,Amount,Category,Tags
+Coffee,-4.50,Dining,daily
+Payroll,2000.00,Income,salary
+Rent,-1200.00,Housing,fixed
+`, `categories: 0 of 3 rows uncategorized
+       1  rule line 2 (Income)
+       0  rule line 3 (Housing)
+       0  rule line 4 (Dining)
+       0  rule line 5 (Large)
+`},
+		{"written rows only", false, false, "Amount < 0", `Description,Amount,Category,Tags
+Coffee,-4.50,Dining,daily
+Rent,-1200.00,Housing,fixed
+`, `categories: 0 of 2 rows uncategorized
+       0  rule line 2 (Income)
+       1  rule line 3 (Housing)
+       1  rule line 4 (Dining)
+       0  rule line 5 (Large)
+`},
+		{"override", true, true, "", `Description,Amount,Category,Tags
+Coffee,-4.50,Dining,daily
+Payroll,2000.00,Income,salary
+Rent,-1200.00,Housing,fixed
+`, `categories: 0 of 3 rows uncategorized
+       1  rule line 2 (Income)
+       1  rule line 3 (Housing)
+       1  rule line 4 (Dining)
+       0  rule line 5 (Large)
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := LoadRules("../cmd/fixtures/rules.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Override = tt.override
+			m := &Merger{Categories: c}
+			if tt.where != "" {
+				if m.Where, err = ParseExpr(tt.where); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.lookup {
+				l, err := ParseLookup("../cmd/fixtures/merchants.csv:Merchant=Description:Category,Tags:icase")
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.Lookups = []*Lookup{l}
+			}
+			w := bytes.NewBufferString("")
+			m.combine(csv.NewWriter(w), []string{"../cmd/fixtures/statement_jan.csv"}, []string{"Description", "Amount", "Category", "Tags"})
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+			if c.Report() != tt.report {
+				t.Errorf("report got:\n%s\nwant:\n%s", c.Report(), tt.report)
+			}
+		})
+	}
+}
+
+func TestCategorizerUncategorized(t *testing.T) {
+	c := NewCategorizer()
+	for _, d := range []string{"Coffee", "Rent", "Coffee", ""} {
+		row := []string{d, "", ""}
+		c.count(c.apply(map[string]int{"Description": 0, "Category": 1, "Tags": 2}, row))
+	}
+	want := `categories: 4 of 4 rows uncategorized
+       2  uncategorized Coffee
+       1  uncategorized (blank)
+       1  uncategorized Rent
+`
+	if c.Report() != want {
+		t.Errorf("report got:\n%s\nwant:\n%s", c.Report(), want)
+	}
+}
@@ -0,0 +1,317 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Computed is an output column whose value is derived from other columns of
+// the same row, e.g.
+//
+//	Net = Credit - Debit
+//	Month = substr(Date, 0, 7)
+//
+// A computed column named like an existing column replaces its value.
+type Computed struct {
+	Name string
+	Expr *Expr
+}
+
+// ParseComputed reads a column definition of the form NAME = EXPRESSION,
+// where NAME is an identifier or a [bracketed] column name.
+func ParseComputed(def string) (Computed, error) {
+	name, i, ok := definedName(def)
+	if !ok {
+		return Computed{}, &ExprError{Expr: def, Pos: 0, Msg: "expected NAME = EXPRESSION"}
+	}
+	e, err := ParseExpr(def[i:])
+	if err != nil {
+		if exprErr, ok := err.(*ExprError); ok {
+			return Computed{}, &ExprError{Expr: def, Pos: exprErr.Pos + i, Msg: exprErr.Msg}
+		}
+		return Computed{}, err
+	}
+	return Computed{Name: name, Expr: e}, nil
+}
+
+// definedName reads the NAME = prefix of a column definition, returning the
+// name and the position of the expression following "=".
+func definedName(def string) (string, int, bool) {
+	i := len(def) - len(strings.TrimLeft(def, " \t"))
+	start := i
+	var name string
+	switch {
+	case i < len(def) && def[i] == '[':
+		end := strings.IndexByte(def[i:], ']')
+		if end < 0 {
+			return "", 0, false
+		}
+		name = def[i+1 : i+end]
+		i += end + 1
+	case i < len(def) && isIdentByte(def[i]):
+		for i < len(def) && (isIdentByte(def[i]) || def[i] >= '0' && def[i] <= '9') {
+			i++
+		}
+		name = def[start:i]
+	}
+	i += len(def[i:]) - len(strings.TrimLeft(def[i:], " \t"))
+	if strings.TrimSpace(name) == "" || !strings.HasPrefix(def[i:], "=") || strings.HasPrefix(def[i:], "==") {
+		return "", 0, false
+	}
+	return name, i + 1, true
+}
+
+// Definition returns the column in the NAME = EXPRESSION form read by
+// ParseComputed.
+func (c Computed) Definition() string {
+	name := c.Name
+	if n, _, ok := definedName(name + "="); !ok || n != name {
+		name = "[" + name + "]"
+	}
+	return fmt.Sprintf("%s = %s", name, strings.TrimSpace(c.Expr.String()))
+}
+
+// SplitComputed separates the column definitions in a config row from plain
+// column names. Each definition is replaced by the name of the column it
+// defines so the returned names can be used with ColumnIndexes. A column
+// not starting with NAME =, such as "Rate (=USD)", is a plain name.
+func SplitComputed(columns []string) ([]string, []Computed, error) {
+	var names []string
+	var computed []Computed
+	for _, col := range columns {
+		if _, _, ok := definedName(col); !ok {
+			names = append(names, col)
+			continue
+		}
+		c, err := ParseComputed(col)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, c.Name)
+		computed = append(computed, c)
+	}
+	return names, computed, nil
+}
+
+// applyComputed evaluates the computed columns, in order, filling them in
+// row, whose columns are positioned by index. Later columns may refer to
+// earlier ones.
+func applyComputed(index map[string]int, row []string, computed []Computed) {
+	for _, c := range computed {
+		row[index[c.Name]] = c.Expr.Eval(rowGetter(index, row)).String()
+	}
+}
+
+// function is a built-in available to expressions. max is -1 for functions
+// taking any number of arguments.
+type function struct {
+	min, max int
+	call     func(args []Value) Value
+}
+
+func (f function) arity() string {
+	switch {
+	case f.min == f.max && f.min == 1:
+		return "1 argument"
+	case f.min == f.max:
+		return fmt.Sprintf("%d arguments", f.min)
+	case f.max < 0:
+		return fmt.Sprintf("at least %d arguments", f.min)
+	}
+	return fmt.Sprintf("%d to %d arguments", f.min, f.max)
+}
+
+var functions = map[string]function{
+	// string
+	"upper":  {1, 1, func(a []Value) Value { return textValue(strings.ToUpper(a[0].String())) }},
+	"lower":  {1, 1, func(a []Value) Value { return textValue(strings.ToLower(a[0].String())) }},
+	"trim":   {1, 1, func(a []Value) Value { return textValue(strings.TrimSpace(a[0].String())) }},
+	"length": {1, 1, func(a []Value) Value { return numberValue(float64(len([]rune(a[0].String()))), 0) }},
+	"substr": {2, 3, substr},
+	"left":   {2, 2, func(a []Value) Value { return substr([]Value{a[0], numberValue(0, 0), a[1]}) }},
+	"right":  {2, 2, right},
+	"replace": {3, 3, func(a []Value) Value {
+		return textValue(strings.ReplaceAll(a[0].String(), a[1].String(), a[2].String()))
+	}},
+	"contains": {2, 2, func(a []Value) Value { return boolValue(strings.Contains(a[0].String(), a[1].String())) }},
+	"concat":   {1, -1, concat},
+	// numeric
+	"number": {1, 1, numeric(func(x float64, scale int) Value { return numberValue(x, scale) })},
+	"abs":    {1, 1, numeric(func(x float64, scale int) Value { return numberValue(math.Abs(x), scale) })},
+	"floor":  {1, 1, numeric(func(x float64, _ int) Value { return numberValue(math.Floor(x), 0) })},
+	"ceil":   {1, 1, numeric(func(x float64, _ int) Value { return numberValue(math.Ceil(x), 0) })},
+	"round":  {1, 2, round},
+	"min":    {1, -1, extreme(-1)},
+	"max":    {1, -1, extreme(1)},
+	// date
+	"date":         {1, 1, dated(func(t time.Time) Value { return dateValue(t) })},
+	"year":         {1, 1, dated(func(t time.Time) Value { return numberValue(float64(t.Year()), 0) })},
+	"month":        {1, 1, dated(func(t time.Time) Value { return numberValue(float64(t.Month()), 0) })},
+	"day":          {1, 1, dated(func(t time.Time) Value { return numberValue(float64(t.Day()), 0) })},
+	"format_date":  {2, 2, formatDate},
+	"add_days":     {2, 2, addDays},
+	"days_between": {2, 2, daysBetween},
+	// conditional
+	"if":       {2, 3, ifElse},
+	"coalesce": {1, -1, coalesce},
+}
+
+func substr(a []Value) Value {
+	r := []rune(a[0].String())
+	start, ok := a[1].Number()
+	if !ok {
+		return textValue("")
+	}
+	from := clamp(int(start), len(r))
+	to := len(r)
+	if len(a) > 2 {
+		n, ok := a[2].Number()
+		if !ok {
+			return textValue("")
+		}
+		to = from + clamp(int(n), len(r)-from) // a negative length takes nothing
+	}
+	return textValue(string(r[from:to]))
+}
+
+func right(a []Value) Value {
+	r := []rune(a[0].String())
+	n, ok := a[1].Number()
+	if !ok {
+		return textValue("")
+	}
+	return textValue(string(r[len(r)-clamp(int(n), len(r)):]))
+}
+
+func clamp(i, n int) int {
+	if i < 0 {
+		return 0
+	} else if i > n {
+		return n
+	}
+	return i
+}
+
+func concat(a []Value) Value {
+	var sb strings.Builder
+	for _, v := range a {
+		sb.WriteString(v.String())
+	}
+	return textValue(sb.String())
+}
+
+// numeric adapts fn to the numeric interpretation of its single argument;
+// anything that isn't a number yields an empty result.
+func numeric(fn func(x float64, scale int) Value) func([]Value) Value {
+	return func(a []Value) Value {
+		x, scale, ok := a[0].decimal()
+		if !ok {
+			return textValue("")
+		}
+		return fn(x, scale)
+	}
+}
+
+func round(a []Value) Value {
+	x, ok := a[0].Number()
+	if !ok {
+		return textValue("")
+	}
+	places := 0.0
+	if len(a) > 1 {
+		if places, ok = a[1].Number(); !ok {
+			return textValue("")
+		}
+	}
+	return numberValue(roundTo(x, int(places)), int(places))
+}
+
+func roundTo(x float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(x*p) / p
+}
+
+// extreme returns the smallest (sign -1) or largest (sign 1) numeric argument.
+func extreme(sign int) func([]Value) Value {
+	return func(a []Value) Value {
+		var best Value
+		found := false
+		for _, v := range a {
+			x, scale, ok := v.decimal()
+			if !ok {
+				continue
+			}
+			if !found || compareOrdered(x, best.num) == sign {
+				best = numberValue(x, scale)
+				found = true
+			}
+		}
+		if !found {
+			return textValue("")
+		}
+		return best
+	}
+}
+
+// dated adapts fn to the date interpretation of its single argument; anything
+// that isn't a date yields an empty result.
+func dated(fn func(t time.Time) Value) func([]Value) Value {
+	return func(a []Value) Value {
+		t, ok := a[0].Date()
+		if !ok {
+			return textValue("")
+		}
+		return fn(t)
+	}
+}
+
+// dateFormat translates the YYYY, MM, DD style patterns accepted by
+// format_date into Go time layouts.
+var dateFormat = strings.NewReplacer("YYYY", "2006", "YY", "06", "MMM", "Jan", "MM", "01", "DD", "02")
+
+func formatDate(a []Value) Value {
+	t, ok := a[0].Date()
+	if !ok {
+		return textValue("")
+	}
+	return textValue(t.Format(dateFormat.Replace(a[1].String())))
+}
+
+func addDays(a []Value) Value {
+	t, ok := a[0].Date()
+	n, isNum := a[1].Number()
+	if !ok || !isNum {
+		return textValue("")
+	}
+	return dateValue(t.AddDate(0, 0, int(n)))
+}
+
+func daysBetween(a []Value) Value {
+	from, ok := a[0].Date()
+	to, ok2 := a[1].Date()
+	if !ok || !ok2 {
+		return textValue("")
+	}
+	return numberValue(math.Round(to.Sub(from).Hours()/24), 0)
+}
+
+func ifElse(a []Value) Value {
+	if a[0].Bool() {
+		return a[1]
+	}
+	if len(a) > 2 {
+		return a[2]
+	}
+	return textValue("")
+}
+
+func coalesce(a []Value) Value {
+	for _, v := range a {
+		if strings.TrimSpace(v.String()) != "" {
+			return v
+		}
+	}
+	return textValue("")
+}
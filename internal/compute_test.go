@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestComputed(t *testing.T) {
+	header := []string{"Date", "Description", "Credit", "Debit", "Amount"}
+	record := []string{"01/15/2024", "  amzn mktp  ", "68.77", "", "-12.30"}
+	var tests = []struct {
+		def  string
+		want string
+	}{
+		{"Month = substr(date(Date), 0, 7)", "2024-01"},
+		{"Month = format_date(Date, 'YYYY-MM')", "2024-01"},
+		{"Net = Credit - Debit", "68.77"},
+		{"Total = Credit + Amount * 2", "44.17"},
+		{"Share = Credit / 4", "17.1925"},
+		{"Vendor = upper(trim(Description))", "AMZN MKTP"},
+		{"Amount = abs(Amount)", "12.30"},
+		{"Rounded = round(Credit, 1)", "68.8"},
+		{"Kind = if(Amount < 0, 'debit', 'credit')", "debit"},
+		{"Due = add_days(Date, 30)", "2024-02-14"},
+		{"Age = days_between(Date, '2024-02-01')", "17"},
+		{"[Debit Or Credit] = coalesce(Debit, Credit)", "68.77"},
+		{"Label = concat(left(trim(Description), 4), '-', right(Date, 4))", "amzn-2024"},
+		{"Middle = substr(Description, 2, -1)", ""},
+		{"Start = left(Description, -3)", ""},
+		{"Bad = Description * 2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.def, func(t *testing.T) {
+			c, err := ParseComputed(tt.def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := extendHeader(header, []string{c.Name})
+			index := headerIndex(h)
+			row := make([]string, len(h))
+			copy(row, record)
+			applyComputed(index, row, []Computed{c})
+			if got := row[index[c.Name]]; got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.def, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseComputedError(t *testing.T) {
+	var tests = []struct {
+		def string
+		pos int
+	}{
+		{"Credit - Debit", 0},
+		{"Net = Credit -", 14},
+		{"Month = substring(Date, 0, 7)", 8},
+		{"Month = substr(Date)", 19},
+		{"Month = substr(Date 0)", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.def, func(t *testing.T) {
+			_, err := ParseComputed(tt.def)
+			var exprErr *ExprError
+			if !errors.As(err, &exprErr) {
+				t.Fatalf("got %v, want an *ExprError", err)
+			}
+			if exprErr.Pos != tt.pos {
+				t.Errorf("got position %d, want %d: %v", exprErr.Pos, tt.pos, err)
+			}
+		})
+	}
+}
+
+func TestSplitComputed(t *testing.T) {
+	names, computed, err := SplitComputed([]string{"Date", "Net = Credit - Debit", "Amount", "Rate (=USD)", "[Net Amount] = Net", "=Total"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Date", "Net", "Amount", "Rate (=USD)", "Net Amount", "=Total"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+	if len(computed) != 2 || computed[0].Definition() != "Net = Credit - Debit" || computed[1].Definition() != "[Net Amount] = Net" {
+		t.Errorf("got computed %v", computed)
+	}
+}
+
+func TestCombineComputed(t *testing.T) {
+	net, _ := ParseComputed("Net = Amount * -1")
+	month, _ := ParseComputed("Month = format_date(Date, 'YYYY-MM')")
+	where, _ := ParseExpr("Net > 0")
+	m := &Merger{Computed: []Computed{net, month}, Where: where}
+	files := []string{"../cmd/fixtures/negative_test.csv"}
+	w := bytes.NewBufferString("")
+	m.combine(csv.NewWriter(w), files, []string{"Month", "Description", "Net"})
+
+	expected := `Month,Description,Net
+2024-01,Purchase 1,50.00
+2024-01,Purchase 2,100.25
+`
+	if w.String() != expected {
+		t.Errorf("TestCombineComputed got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+}
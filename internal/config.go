@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConfigAliasSeparator separates the other names of a column in the second
+// row of a config file.
+const ConfigAliasSeparator = "|"
+
+// RenameArrow separates, in a column of a config file, the name of a column
+// from the name it is given in the output, as in "Transaction Date -> txn_date".
+const RenameArrow = "->"
+
+// NegateMark starts, in a config file, a column whose values are negated, as
+// in "-Amount".
+const NegateMark = "-"
+
+// Config is the content of a config file: the selected columns, in output
+// order, with the columns computed, renamed, negated, marked optional and
+// known by other names in some files.
+type Config struct {
+	Columns  []string
+	Computed []Computed
+	Rename   map[string]string
+	Negate   []string
+	Optional map[string]bool
+	Aliases  map[string][]string
+}
+
+// LoadConfig reads a config file: a row of columns and an optional row of
+// their aliases.
+func LoadConfig(f string) (*Config, error) {
+	src := openFile(f)
+	defer closeFile(src)
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1 // the aliases row may be shorter
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", f)
+	}
+	c := &Config{}
+	columns, renames, err := SplitRenames(records[0])
+	if err != nil {
+		return nil, err
+	}
+	if columns, c.Computed, err = SplitComputed(columns); err != nil {
+		return nil, err
+	}
+	columns, c.Negate = SplitNegated(columns)
+	c.Columns, c.Optional = SplitOptional(columns)
+	for i, col := range c.Negate {
+		// a negated column may be optional as well: -Amount?
+		c.Negate[i] = strings.TrimSpace(strings.TrimSuffix(col, OptionalColumnSuffix))
+	}
+	c.Rename = make(map[string]string)
+	for i, to := range renames {
+		if to != "" {
+			c.Rename[c.Columns[i]] = to
+		}
+	}
+	if len(records) > 1 {
+		c.Aliases = make(map[string][]string)
+		for i, cell := range records[1] {
+			if i >= len(c.Columns) || strings.TrimSpace(cell) == "" {
+				continue
+			}
+			for _, a := range strings.Split(cell, ConfigAliasSeparator) {
+				if a = strings.TrimSpace(a); a != "" {
+					c.Aliases[c.Columns[i]] = append(c.Aliases[c.Columns[i]], a)
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// Records returns the rows of the config file holding c: its columns and,
+// when some have aliases, their aliases.
+func (c *Config) Records() [][]string {
+	defs := make(map[string]string)
+	for _, cc := range c.Computed {
+		defs[cc.Name] = cc.Definition()
+	}
+	columns := make([]string, len(c.Columns))
+	for i, col := range c.Columns {
+		if def, ok := defs[col]; ok {
+			columns[i] = def
+			continue
+		}
+		columns[i] = col
+		if contains(c.Negate, col) {
+			columns[i] = NegateMark + columns[i]
+		}
+		if c.Optional[col] {
+			columns[i] += OptionalColumnSuffix
+		}
+		if to, ok := c.Rename[col]; ok {
+			columns[i] += " " + RenameArrow + " " + to
+		}
+	}
+	records := [][]string{columns}
+	if len(c.Aliases) > 0 {
+		// a second row holds the other names of each column, | separated
+		aliases := make([]string, len(c.Columns))
+		for i, col := range c.Columns {
+			aliases[i] = strings.Join(c.Aliases[col], ConfigAliasSeparator)
+		}
+		records = append(records, aliases)
+	}
+	return records
+}
+
+// SaveConfig writes c to the config file f.
+func SaveConfig(f string, c *Config) error {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.WriteAll(c.Records())
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return os.WriteFile(f, b.Bytes(), 0644)
+}
+
+// Config returns the config selecting columns with the renames, negations
+// and aliases of m.
+func (m *Merger) Config(columns []string) *Config {
+	c := &Config{Columns: columns, Computed: m.Computed, Rename: m.Rename, Aliases: m.Aliases}
+	for _, col := range m.NegateColumns {
+		if contains(columns, col) && !contains(c.Negate, col) {
+			c.Negate = append(c.Negate, col)
+		}
+	}
+	return c
+}
+
+// SplitNegated returns columns without their negate marks, and the names of
+// those marked.
+func SplitNegated(columns []string) ([]string, []string) {
+	names := make([]string, len(columns))
+	var negated []string
+	for i, col := range columns {
+		names[i] = col
+		if strings.Contains(col, "=") {
+			continue
+		}
+		if name := strings.TrimPrefix(strings.TrimSpace(col), NegateMark); name != strings.TrimSpace(col) {
+			names[i] = strings.TrimSpace(name)
+			negated = append(negated, names[i])
+		}
+	}
+	return names, negated
+}
+
+// ParseRename reads a rename written as COLUMN -> NAME.
+func ParseRename(s string) (from, to string, err error) {
+	from, to, found := strings.Cut(s, RenameArrow)
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !found || from == "" || to == "" {
+		return "", "", fmt.Errorf("rename %q: expected COLUMN %s NAME", s, RenameArrow)
+	}
+	return from, to, nil
+}
+
+// SplitRenames returns columns without their renames, and the name each
+// is renamed to, or "" when it is not. Computed columns name themselves
+// and are left alone.
+func SplitRenames(columns []string) ([]string, []string, error) {
+	names := make([]string, len(columns))
+	renames := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col
+		if strings.Contains(col, "=") || !strings.Contains(col, RenameArrow) {
+			continue
+		}
+		from, to, err := ParseRename(col)
+		if err != nil {
+			return nil, nil, err
+		}
+		names[i], renames[i] = from, to
+	}
+	return names, renames, nil
+}
+
+// projection renames and reorders the cells of rows as asked by the
+// Rename and Order of a Merger.
+type projection struct {
+	header []string
+	order  []int // the position in the row of each output cell; nil to keep rows as they are
+}
+
+// project returns the projection of rows aligned to header; display is
+// header as it would be written without renames.
+func (m *Merger) project(header, display []string) projection {
+	p := projection{header: display}
+	if len(m.Rename) == 0 && len(m.Order) == 0 {
+		return p
+	}
+	p.header = make([]string, len(header))
+	for i, h := range header {
+		p.header[i] = display[i]
+		if to, ok := m.Rename[h]; ok {
+			p.header[i] = to
+		}
+	}
+	if len(m.Order) == 0 {
+		return p
+	}
+	// the columns in Order, by output or input name, come first
+	placed := make([]bool, len(header))
+	for _, name := range m.Order {
+		for i, h := range header {
+			if !placed[i] && (p.header[i] == name || h == name) {
+				p.order = append(p.order, i)
+				placed[i] = true
+				break
+			}
+		}
+	}
+	for i := range header {
+		if !placed[i] {
+			p.order = append(p.order, i)
+		}
+	}
+	reordered := make([]string, len(header))
+	for j, i := range p.order {
+		reordered[j] = p.header[i]
+	}
+	p.header = reordered
+	return p
+}
+
+// apply returns row in output order. Cells past the header, such as a
+// running balance, stay at the end.
+func (p projection) apply(row []string) []string {
+	if p.order == nil {
+		return row
+	}
+	out := make([]string, 0, len(row))
+	for _, i := range p.order {
+		out = append(out, row[i])
+	}
+	return append(out, row[len(p.order):]...)
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "cfg.csv")
+	content := "Transaction Date -> txn_date,Memo?,-Amount,Sign = Amount < 0\nTrans. Date|Posted,,Amt\n"
+	if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Transaction Date", "Memo", "Amount", "Sign"}; !reflect.DeepEqual(c.Columns, want) {
+		t.Errorf("Columns = %q, want %q", c.Columns, want)
+	}
+	if len(c.Computed) != 1 || c.Computed[0].Name != "Sign" {
+		t.Errorf("Computed = %v", c.Computed)
+	}
+	if want := map[string]string{"Transaction Date": "txn_date"}; !reflect.DeepEqual(c.Rename, want) {
+		t.Errorf("Rename = %v, want %v", c.Rename, want)
+	}
+	if want := []string{"Amount"}; !reflect.DeepEqual(c.Negate, want) {
+		t.Errorf("Negate = %q, want %q", c.Negate, want)
+	}
+	if want := map[string]bool{"Memo": true}; !reflect.DeepEqual(c.Optional, want) {
+		t.Errorf("Optional = %v, want %v", c.Optional, want)
+	}
+	if want := map[string][]string{"Transaction Date": {"Trans. Date", "Posted"}, "Amount": {"Amt"}}; !reflect.DeepEqual(c.Aliases, want) {
+		t.Errorf("Aliases = %v, want %v", c.Aliases, want)
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	sign, err := ParseComputed("Sign = Amount < 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Merger{
+		Computed:      []Computed{sign},
+		Rename:        map[string]string{"Transaction Date": "txn_date"},
+		NegateColumns: []string{"Amount", "Balance"},
+		Aliases:       map[string][]string{"Amount": {"Amt"}},
+	}
+	c := m.Config([]string{"Transaction Date", "Amount", "Sign"})
+	c.Optional = map[string]bool{"Amount": true}
+	f := filepath.Join(t.TempDir(), "cfg.csv")
+	if err := SaveConfig(f, c); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Transaction Date -> txn_date,-Amount?,Sign = Amount < 0\n,Amt,\n"; string(b) != want {
+		t.Errorf("saved:\n%s\nwant:\n%s", b, want)
+	}
+	loaded, err := LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Columns, c.Columns) || !reflect.DeepEqual(loaded.Negate, c.Negate) || !reflect.DeepEqual(loaded.Rename, c.Rename) || !reflect.DeepEqual(loaded.Aliases, c.Aliases) {
+		t.Errorf("loaded %+v, saved %+v", loaded, c)
+	}
+}
+
+func TestParseRename(t *testing.T) {
+	from, to, err := ParseRename(" Transaction Date->txn_date ")
+	if err != nil || from != "Transaction Date" || to != "txn_date" {
+		t.Errorf("ParseRename() = %q, %q, %v", from, to, err)
+	}
+	for _, s := range []string{"Amount", "-> amount", "Amount ->"} {
+		if _, _, err := ParseRename(s); err == nil {
+			t.Errorf("ParseRename(%q) should fail", s)
+		}
+	}
+}
+
+func TestCombineRenameOrder(t *testing.T) {
+	files := []string{"../cmd/fixtures/transactions.CSV"}
+	columns := []string{"Transaction Date", "Category", "Amount"}
+	var tests = []struct {
+		name     string
+		m        *Merger
+		expected string
+	}{
+		{"rename", &Merger{Rename: map[string]string{"Transaction Date": "txn_date"}},
+			"txn_date,Category,Amount\n20221231,Merchandise,12.36\n20230115,Grocery,68.77\n20230131,Dining,39.98\n"},
+		{"order by output name", &Merger{Rename: map[string]string{"Amount": "amount"}, Order: []string{"amount", "Category"}},
+			"amount,Category,Transaction Date\n12.36,Merchandise,20221231\n68.77,Grocery,20230115\n39.98,Dining,20230131\n"},
+		{"unified with balance", &Merger{Order: []string{"Amount"}, Balance: &RunningBalance{AmountColumn: "Amount"}},
+			"Amount,Transaction Date,Category,RunningBalance\n12.36,20221231,Merchandise,12.36\n68.77,20230115,Grocery,81.13\n39.98,20230131,Dining,121.11\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := bytes.NewBufferString("")
+			tt.m.combine(csv.NewWriter(w), files, columns)
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+		})
+	}
+}
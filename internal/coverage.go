@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OptionalColumnSuffix marks, at the end of a column of a config file, a
+// column the input files need not have.
+const OptionalColumnSuffix = "?"
+
+// SplitOptional returns columns without their optional marks, and the
+// names of those marked optional.
+func SplitOptional(columns []string) ([]string, map[string]bool) {
+	names := make([]string, len(columns))
+	optional := make(map[string]bool)
+	for i, col := range columns {
+		names[i] = col
+		if strings.Contains(col, "=") {
+			continue // computed columns are always there
+		}
+		if name := strings.TrimSuffix(strings.TrimSpace(col), OptionalColumnSuffix); name != strings.TrimSpace(col) {
+			names[i] = strings.TrimSpace(name)
+			optional[names[i]] = true
+		}
+	}
+	return names, optional
+}
+
+// Coverage is the selected columns one input file has and lacks.
+type Coverage struct {
+	File            string
+	Found           []string
+	Missing         []string // required columns the file lacks
+	MissingOptional []string
+}
+
+func (c Coverage) String() string {
+	total := len(c.Found) + len(c.Missing) + len(c.MissingOptional)
+	if len(c.Found) == total {
+		return fmt.Sprintf("coverage: %s: all %d columns\n", c.File, total)
+	}
+	missing := append([]string{}, c.Missing...)
+	for _, col := range c.MissingOptional {
+		missing = append(missing, col+" (optional)")
+	}
+	return fmt.Sprintf("coverage: %s: %d of %d columns, missing %s\n", c.File, len(c.Found), total, strings.Join(missing, ", "))
+}
+
+// Coverage returns, for each of files, which of columns it has, under any
+// spelling matched by NormalizeHeader or Aliases, or as a derived column.
+// Columns in optional are reported apart when missing.
+func (m *Merger) Coverage(files []string, columns []string, optional map[string]bool) []Coverage {
+	var coverage []Coverage
+	for _, f := range files {
+		s := m.scan(f, columns)
+		c := Coverage{File: f}
+		seen := make(map[string]bool)
+		for _, col := range columns {
+			if seen[col] {
+				continue
+			}
+			seen[col] = true
+			_, ok := s.index[col]
+			switch {
+			case ok:
+				c.Found = append(c.Found, col)
+			case optional[col]:
+				c.MissingOptional = append(c.MissingOptional, col)
+			default:
+				c.Missing = append(c.Missing, col)
+			}
+		}
+		s.close()
+		coverage = append(coverage, c)
+	}
+	return coverage
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitOptional(t *testing.T) {
+	names, optional := SplitOptional([]string{"Date", "Memo?", " Category ? ", "Debit = Amount < 0"})
+	want := []string{"Date", "Memo", "Category", "Debit = Amount < 0"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+	if !reflect.DeepEqual(optional, map[string]bool{"Memo": true, "Category": true}) {
+		t.Errorf("optional = %v", optional)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	files := []string{"../cmd/fixtures/transactions.CSV", "../cmd/fixtures/card_export.csv"}
+	m := &Merger{Aliases: map[string][]string{"Amount": {"Amt"}}}
+	got := m.Coverage(files, []string{"Transaction Date", "category", "Amount", "Memo"}, map[string]bool{"Memo": true})
+	want := []Coverage{
+		{File: files[0], Found: []string{"Transaction Date", "category", "Amount"}, MissingOptional: []string{"Memo"}},
+		{File: files[1], Found: []string{"Amount"}, Missing: []string{"Transaction Date", "category"}, MissingOptional: []string{"Memo"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Coverage() = %+v, want %+v", got, want)
+	}
+	if s := got[1].String(); s != "coverage: ../cmd/fixtures/card_export.csv: 1 of 4 columns, missing Transaction Date, category, Memo (optional)\n" {
+		t.Errorf("String() = %q", s)
+	}
+	if s := got[0].String(); s != "coverage: ../cmd/fixtures/transactions.CSV: 3 of 4 columns, missing Memo (optional)\n" {
+		t.Errorf("String() = %q", s)
+	}
+}
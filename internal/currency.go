@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OriginalAmountColumn and OriginalCurrencyColumn are the columns added by
+// currency conversion, holding a row's amount before conversion.
+const (
+	OriginalAmountColumn   = "OriginalAmount"
+	OriginalCurrencyColumn = "OriginalCurrency"
+)
+
+// Rates is a table of dated exchange rates, read from a CSV file with the
+// columns Date, From, To and Rate, where 1 From is worth Rate To.
+type Rates struct {
+	File  string
+	pairs map[[2]string][]datedRate // sorted by date
+}
+
+type datedRate struct {
+	date time.Time
+	rate float64
+}
+
+// LoadRates reads a rates file.
+func LoadRates(file string) (*Rates, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(f)
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	index := headerIndex(records[0])
+	for _, c := range []string{"Date", "From", "To", "Rate"} {
+		if _, ok := index[c]; !ok {
+			return nil, fmt.Errorf("%s: missing the %s column, want Date,From,To,Rate", file, c)
+		}
+	}
+	r := &Rates{File: file, pairs: make(map[[2]string][]datedRate)}
+	for n, rec := range records[1:] {
+		date, ok := ParseDate(rec[index["Date"]])
+		if !ok {
+			return nil, fmt.Errorf("%s line %d: %q is not a date", file, n+2, rec[index["Date"]])
+		}
+		rate, ok := ParseNumber(rec[index["Rate"]])
+		if !ok || rate <= 0 {
+			return nil, fmt.Errorf("%s line %d: %q is not a rate", file, n+2, rec[index["Rate"]])
+		}
+		pair := [2]string{currencyCode(rec[index["From"]]), currencyCode(rec[index["To"]])}
+		r.pairs[pair] = append(r.pairs[pair], datedRate{date, rate})
+	}
+	for _, rates := range r.pairs {
+		sort.SliceStable(rates, func(i, j int) bool { return rates[i].date.Before(rates[j].date) })
+	}
+	return r, nil
+}
+
+func currencyCode(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// direct returns the rate of from in to on the latest date not after date,
+// using the inverse of the to-from rate when only that is known.
+func (r *Rates) direct(from, to string, date time.Time) (float64, bool) {
+	latest := func(rates []datedRate) (float64, bool) {
+		i := sort.Search(len(rates), func(i int) bool { return rates[i].date.After(date) })
+		if i == 0 {
+			return 0, false
+		}
+		return rates[i-1].rate, true
+	}
+	if rate, ok := latest(r.pairs[[2]string{from, to}]); ok {
+		return rate, true
+	}
+	if rate, ok := latest(r.pairs[[2]string{to, from}]); ok {
+		return 1 / rate, true
+	}
+	return 0, false
+}
+
+// Rate returns the rate converting from into to on date: the rate of the
+// nearest previous date, either quoted directly, inverted, or crossed
+// through a third currency, e.g. EUR to GBP through USD.
+func (r *Rates) Rate(from, to string, date time.Time) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	if rate, ok := r.direct(from, to, date); ok {
+		return rate, true
+	}
+	var via []string
+	seen := make(map[string]bool)
+	for pair := range r.pairs {
+		for _, c := range pair {
+			if !seen[c] && c != from && c != to {
+				seen[c] = true
+				via = append(via, c)
+			}
+		}
+	}
+	sort.Strings(via)
+	for _, c := range via {
+		a, ok := r.direct(from, c, date)
+		if !ok {
+			continue
+		}
+		if b, ok := r.direct(c, to, date); ok {
+			return a * b, true
+		}
+	}
+	return 0, false
+}
+
+// Conversion converts the amounts of rows to the Target currency. A row's
+// currency is read from CurrencyColumn or, when blank or missing, looked up
+// by input file in FileCurrency (keyed by path or base name). The amount
+// before conversion is kept in the OriginalAmount and OriginalCurrency
+// columns; rows of an unknown currency, or dated before any usable rate, are
+// left as they are.
+type Conversion struct {
+	Rates          *Rates
+	Target         string
+	AmountColumn   string
+	DateColumn     string
+	CurrencyColumn string
+	FileCurrency   map[string]string
+
+	missing map[string]int // currency -> rows without a rate
+}
+
+// ParseFileCurrencies reads per-file currencies written as FILE=CURRENCY.
+func ParseFileCurrencies(specs []string) (map[string]string, error) {
+	currencies := make(map[string]string)
+	for _, s := range specs {
+		file, code, found := strings.Cut(s, "=")
+		if !found || strings.TrimSpace(file) == "" || strings.TrimSpace(code) == "" {
+			return nil, fmt.Errorf("currency %q: expected FILE=CURRENCY", s)
+		}
+		currencies[strings.TrimSpace(file)] = currencyCode(code)
+	}
+	return currencies, nil
+}
+
+// Columns returns the names of the columns conversion writes.
+func (c *Conversion) Columns() []string {
+	return []string{OriginalAmountColumn, OriginalCurrencyColumn}
+}
+
+// currencyOf returns the currency of a row of file.
+func (c *Conversion) currencyOf(file string, get func(string) string) string {
+	if code := currencyCode(get(c.CurrencyColumn)); code != "" {
+		return code
+	}
+	if code, ok := c.FileCurrency[file]; ok {
+		return code
+	}
+	return c.FileCurrency[filepath.Base(file)]
+}
+
+// apply converts the amount of row, read from file, whose columns are
+// positioned by index.
+func (c *Conversion) apply(file string, index map[string]int, row []string) {
+	get := rowGetter(index, row)
+	code := c.currencyOf(file, get)
+	value := get(c.AmountColumn)
+	amount, ok := ParseNumber(value)
+	if code == "" || !ok {
+		return
+	}
+	target := currencyCode(c.Target)
+	rate := 1.0
+	if code != target {
+		date, ok := ParseDate(get(c.DateColumn))
+		if ok {
+			rate, ok = c.Rates.Rate(code, target, date)
+		}
+		if !ok {
+			if c.missing == nil {
+				c.missing = make(map[string]int)
+			}
+			c.missing[code]++
+			return
+		}
+	}
+	places := DecimalPlaces(value)
+	if places < 2 {
+		places = 2
+	}
+	row[index[OriginalAmountColumn]] = value
+	row[index[OriginalCurrencyColumn]] = code
+	row[index[c.AmountColumn]] = FormatNumber(roundTo(amount*rate, places), places)
+	if i, ok := index[c.CurrencyColumn]; ok {
+		row[i] = target
+	}
+}
+
+// resetStats forgets the rows seen so far, for pipelines reading the input
+// more than once.
+func (c *Conversion) resetStats() {
+	c.missing = nil
+}
+
+// Report lists the rows left unconverted for lack of a rate.
+func (c *Conversion) Report() string {
+	if len(c.missing) == 0 {
+		return ""
+	}
+	codes := make([]string, 0, len(c.missing))
+	for code := range c.missing {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	var sb strings.Builder
+	for _, code := range codes {
+		fmt.Fprintf(&sb, "currency: %d %s rows not converted to %s, no rate in %s\n", c.missing[code], code, currencyCode(c.Target), c.Rates.File)
+	}
+	return sb.String()
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"testing"
+)
+
+func TestRatesRate(t *testing.T) {
+	rates, err := LoadRates("../cmd/fixtures/rates.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		from, to, date string
+		want           float64
+		found          bool
+	}{
+		{"EUR", "USD", "2024-03-01", 1.08, true},
+		{"EUR", "USD", "2024-03-14", 1.08, true},
+		{"EUR", "USD", "2024-03-15", 1.09, true},
+		{"EUR", "USD", "2024-02-29", 0, false},
+		{"USD", "EUR", "2024-04-01", 1 / 1.09, true},
+		{"EUR", "GBP", "2024-03-16", 1.09 * 0.79, true},
+		{"GBP", "EUR", "2024-03-02", 1 / 0.79 / 1.08, true},
+		{"USD", "USD", "1999-01-01", 1, true},
+		{"JPY", "USD", "2024-03-16", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+tt.to+tt.date, func(t *testing.T) {
+			date, _ := ParseDate(tt.date)
+			got, found := rates.Rate(tt.from, tt.to, date)
+			if found != tt.found || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Rate(%s, %s, %s) = %v, %v, want %v, %v", tt.from, tt.to, tt.date, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestLoadRatesError(t *testing.T) {
+	for _, file := range []string{"../cmd/fixtures/missing.csv", "../cmd/fixtures/statement_jan.csv"} {
+		if _, err := LoadRates(file); err == nil {
+			t.Errorf("LoadRates(%q) should fail", file)
+		}
+	}
+}
+
+func TestCombineCurrency(t *testing.T) {
+	rates, err := LoadRates("../cmd/fixtures/rates.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Conversion{Rates: rates, Target: "usd", AmountColumn: "Amount", DateColumn: "Date", CurrencyColumn: "Currency",
+		FileCurrency: map[string]string{"eur_account.csv": "EUR"}}
+	m := &Merger{Currency: c, Unified: true}
+	w := bytes.NewBufferString("")
+	m.combine(csv.NewWriter(w), []string{"../cmd/fixtures/eur_account.csv", "../cmd/fixtures/cards.csv"}, nil)
+
+	expected := `Date,Description,Amount,OriginalAmount,OriginalCurrency,Currency
+2024-02-28,Bakery,-3.20,,,
+2024-03-05,Hotel Paris,-259.20,-240.00,EUR,
+2024-03-20,Refund,21.80,20.00,EUR,
+2024-03-02,Books,-45.00,-45.00,USD,USD
+2024-03-03,Tea London,-12.66,-10.00,GBP,USD
+2024-03-16,Museum,-32.70,-30.00,EUR,USD
+2024-03-17,Train,-12.00,,,
+`
+	if w.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+	if want := "currency: 1 EUR rows not converted to USD, no rate in ../cmd/fixtures/rates.csv\n"; c.Report() != want {
+		t.Errorf("report got %q, want %q", c.Report(), want)
+	}
+}
@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "golang.org/x/exp/slog"
+)
+
+// DefaultDedupeMemoryLimit is the number of row keys held in memory before
+// the deduper spills them to disk.
+const DefaultDedupeMemoryLimit = 1 << 20
+
+// dedupePartitions is the number of temp files keys are spread over once they
+// no longer fit in memory; each is resolved in memory on its own.
+const dedupePartitions = 64
+
+// Dedupe configures the removal of duplicate rows across input files.
+type Dedupe struct {
+	// Key lists the columns identifying a row. When empty, whole output rows
+	// are compared.
+	Key []string
+	// KeepLast keeps the last occurrence of a duplicated row rather than the
+	// first.
+	KeepLast bool
+	// MemoryLimit is the number of keys held in memory before spilling to
+	// disk; DefaultDedupeMemoryLimit when zero.
+	MemoryLimit int
+}
+
+// dedupeEntry is one data row as seen by the deduper.
+type dedupeEntry struct {
+	seq  int // position of the row across all input files
+	file int
+	key  string
+}
+
+// deduper decides which rows of a combine are duplicates. Every row's key is
+// collected in a first pass over the input; keys are kept in memory until
+// MemoryLimit is reached and are then spread by hash over partition files
+// that are resolved one at a time, so only a fraction of the keys is ever in
+// memory. The outcome is a bit per row, consulted by the second pass.
+type deduper struct {
+	opts    Dedupe
+	files   []string
+	entries []dedupeEntry
+	dir     string
+	parts   []*csv.Writer
+	handles []*os.File
+	kept    []uint64
+	rows    int
+	report  DedupeReport
+}
+
+// DedupeReport counts the duplicate rows dropped from each input file and the
+// file holding the row each one duplicated.
+type DedupeReport struct {
+	Files   []string
+	Dropped map[[2]int]int // [dropped file, kept file] -> rows
+}
+
+// Total returns the number of duplicate rows dropped.
+func (r DedupeReport) Total() int {
+	n := 0
+	for _, c := range r.Dropped {
+		n += c
+	}
+	return n
+}
+
+func (r DedupeReport) String() string {
+	if r.Total() == 0 {
+		return "duplicates: none found\n"
+	}
+	pairs := make([][2]int, 0, len(r.Dropped))
+	for p := range r.Dropped {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "duplicates: %d rows dropped\n", r.Total())
+	for _, p := range pairs {
+		fmt.Fprintf(&sb, "  %d from %s (duplicating %s)\n", r.Dropped[p], r.Files[p[0]], r.Files[p[1]])
+	}
+	return sb.String()
+}
+
+// findDuplicates runs the first pass of a deduplicating combine.
+func (m *Merger) findDuplicates(files []string, columns []string) *deduper {
+	d := &deduper{opts: *m.Dedupe, files: files}
+	if d.opts.MemoryLimit <= 0 {
+		d.opts.MemoryLimit = DefaultDedupeMemoryLimit
+	}
+	d.report = DedupeReport{Files: files, Dropped: make(map[[2]int]int)}
+	for i, f := range files {
+		s := m.scan(f, columns)
+		keyed := d.keyed(s)
+		for record, ok := s.next(); ok; record, ok = s.next() {
+			if keyed {
+				d.add(i, d.key(s, record))
+			} else {
+				d.add(i, "")
+			}
+		}
+		s.close()
+	}
+	d.resolve()
+	log.Debug("dedupe", "rows", d.rows, "dropped", d.report.Total(), "spilled", d.dir != "")
+	return d
+}
+
+// keyed reports whether the rows of s can be compared. Files lacking one of
+// the key columns are never deduplicated.
+func (d *deduper) keyed(s *fileScan) bool {
+	for _, k := range d.opts.Key {
+		if _, ok := s.index[k]; !ok {
+			log.Info("file lacks dedupe key column, keeping all of its rows", "file", s.file, "column", k)
+			return false
+		}
+	}
+	return s.header != nil
+}
+
+func (d *deduper) key(s *fileScan, record []string) string {
+	if len(d.opts.Key) == 0 {
+		return strings.Join(s.output(record), "\x1f")
+	}
+	values := make([]string, len(d.opts.Key))
+	for i, k := range d.opts.Key {
+		values[i] = record[s.index[k]]
+	}
+	return strings.Join(values, "\x1f")
+}
+
+// add records the next row. Rows with an empty key are unique.
+func (d *deduper) add(file int, key string) {
+	seq := d.rows
+	d.rows++
+	if seq/64 >= len(d.kept) {
+		d.kept = append(d.kept, 0)
+	}
+	d.kept[seq/64] |= 1 << (seq % 64)
+	if key == "" {
+		return
+	}
+	e := dedupeEntry{seq: seq, file: file, key: key}
+	if d.parts != nil {
+		d.spill(e)
+		return
+	}
+	d.entries = append(d.entries, e)
+	if len(d.entries) >= d.opts.MemoryLimit {
+		d.startSpilling()
+	}
+}
+
+func (d *deduper) startSpilling() {
+	dir, err := os.MkdirTemp("", "merger-dedupe-")
+	if err != nil {
+		LogPanic("Unable to create temp directory.", err)
+	}
+	d.dir = dir
+	for i := 0; i < dedupePartitions; i++ {
+		f, err := os.Create(filepath.Join(dir, strconv.Itoa(i)+".csv"))
+		if err != nil {
+			LogPanic("Unable to create temp file.", err, "dir", dir)
+		}
+		d.handles = append(d.handles, f)
+		d.parts = append(d.parts, csv.NewWriter(f))
+	}
+	for _, e := range d.entries {
+		d.spill(e)
+	}
+	d.entries = nil
+}
+
+func (d *deduper) spill(e dedupeEntry) {
+	h := fnv.New64a()
+	h.Write([]byte(e.key))
+	writeLine(d.parts[h.Sum64()%dedupePartitions], []string{strconv.Itoa(e.seq), strconv.Itoa(e.file), e.key})
+}
+
+// resolve decides which row of each group of duplicates is kept.
+func (d *deduper) resolve() {
+	if d.parts == nil {
+		d.resolveEntries(d.entries)
+		d.entries = nil
+		return
+	}
+	for i, w := range d.parts {
+		w.Flush()
+		closeFile(d.handles[i])
+		r := csv.NewReader(openFile(d.handles[i].Name()))
+		records, err := r.ReadAll()
+		if err != nil {
+			LogPanic("Error reading temp file.", err, "file", d.handles[i].Name())
+		}
+		entries := make([]dedupeEntry, len(records))
+		for j, rec := range records {
+			seq, _ := strconv.Atoi(rec[0])
+			file, _ := strconv.Atoi(rec[1])
+			entries[j] = dedupeEntry{seq: seq, file: file, key: rec[2]}
+		}
+		d.resolveEntries(entries)
+	}
+}
+
+// resolveEntries clears the kept bit of every duplicate among entries, which
+// are in input order.
+func (d *deduper) resolveEntries(entries []dedupeEntry) {
+	winner := make(map[string]int, len(entries))
+	for i, e := range entries {
+		if _, seen := winner[e.key]; !seen || d.opts.KeepLast {
+			winner[e.key] = i
+		}
+	}
+	for i, e := range entries {
+		w := winner[e.key]
+		if w == i {
+			continue
+		}
+		d.kept[e.seq/64] &^= 1 << (e.seq % 64)
+		d.report.Dropped[[2]int{e.file, entries[w].file}]++
+	}
+}
+
+// keep reports whether the row at position seq survives deduplication.
+func (d *deduper) keep(seq int) bool {
+	return d.kept[seq/64]&(1<<(seq%64)) != 0
+}
+
+func (d *deduper) close() {
+	if d.dir != "" {
+		_ = os.RemoveAll(d.dir)
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCombineDedupe(t *testing.T) {
+	files := []string{"../cmd/fixtures/statement_jan.csv", "../cmd/fixtures/statement_feb.csv"}
+	var tests = []struct {
+		name    string
+		dedupe  Dedupe
+		columns []string
+		want    string
+		dropped map[[2]int]int
+	}{
+		{
+			"whole rows keep first",
+			Dedupe{},
+			nil,
+			`Date,Description,Amount,Balance
+2024-01-30,Coffee,-4.50,995.50
+2024-01-31,Payroll,2000.00,2995.50
+2024-02-01,Rent,-1200.00,1795.50
+Date,Description,Amount,Balance
+2024-02-02,Coffee,-4.50,1791.00
+`,
+			map[[2]int]int{{1, 0}: 2},
+		},
+		{
+			"key keep last",
+			Dedupe{Key: []string{"Description", "Amount"}, KeepLast: true},
+			[]string{"Date", "Description"},
+			`Date,Description
+Date,Description
+2024-02-01,Rent
+2024-02-02,Coffee
+2024-01-31,Payroll
+`,
+			map[[2]int]int{{0, 1}: 3},
+		},
+		{
+			"key spilled to disk",
+			Dedupe{Key: []string{"Description", "Amount"}, KeepLast: true, MemoryLimit: 2},
+			[]string{"Date", "Description"},
+			`Date,Description
+Date,Description
+2024-02-01,Rent
+2024-02-02,Coffee
+2024-01-31,Payroll
+`,
+			map[[2]int]int{{0, 1}: 3},
+		},
+		{
+			"missing key column",
+			Dedupe{Key: []string{"Memo"}},
+			[]string{"Description"},
+			`Description
+Coffee
+Payroll
+Rent
+Description
+Rent
+Coffee
+Payroll
+`,
+			map[[2]int]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dedupe := tt.dedupe
+			m := &Merger{Dedupe: &dedupe}
+			w := bytes.NewBufferString("")
+			m.combine(csv.NewWriter(w), files, tt.columns)
+			if w.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.want)
+			}
+
+			d := m.findDuplicates(files, tt.columns)
+			defer d.close()
+			if len(d.report.Dropped) != len(tt.dropped) {
+				t.Errorf("got report %v, want %v", d.report.Dropped, tt.dropped)
+			}
+			for k, v := range tt.dropped {
+				if d.report.Dropped[k] != v {
+					t.Errorf("got report %v, want %v", d.report.Dropped, tt.dropped)
+				}
+			}
+		})
+	}
+}
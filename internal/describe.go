@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+)
+
+// ColumnInfo describes a column of an input file for picking columns: the
+// kind of values it holds, "date", "number" or "text", and a few of them.
+type ColumnInfo struct {
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"`
+	Samples []string `json:"samples"`
+}
+
+// Describe returns the columns of each of files, read as for a merge.
+func (m *Merger) Describe(files []string) [][]ColumnInfo {
+	described := make([][]ColumnInfo, len(files))
+	for i, f := range files {
+		p := m.profile(f)
+		for j, h := range p.header {
+			info := ColumnInfo{Name: h, Samples: p.samples[j]}
+			if p.known[j] {
+				info.Kind = kindName(p.kinds[j])
+			}
+			described[i] = append(described[i], info)
+		}
+	}
+	return described
+}
+
+func kindName(k valueKind) string {
+	switch k {
+	case kindDate:
+		return "date"
+	case kindNumber:
+		return "number"
+	}
+	return "text"
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Preview returns the first lines of the output of combining files on
+// columns, without writing the output file or printing progress.
+func (m *Merger) Preview(files []string, columns []string, lines int) string {
+	p := *m
+	p.quiet = true
+	l := &lineLimiter{n: lines}
+	w := csv.NewWriter(l)
+	p.combine(w, files, columns)
+	w.Flush()
+	return l.buf.String()
+}
+
+// lineLimiter keeps the first n lines written to it and drops the rest.
+type lineLimiter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (l *lineLimiter) Write(b []byte) (int, error) {
+	for _, c := range b {
+		if l.n <= 0 {
+			break
+		}
+		l.buf.WriteByte(c)
+		if c == '\n' {
+			l.n--
+		}
+	}
+	return len(b), nil
+}
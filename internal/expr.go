@@ -0,0 +1,662 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a compiled row expression such as
+//
+//	Category != 'Transfer' and Amount > 100
+//
+// Column names are referenced by header, either bare (Amount) or in brackets
+// when they contain spaces ([Transaction Date]). Comparisons are numeric when
+// both sides are numbers, chronological when both sides are dates and textual
+// otherwise.
+type Expr struct {
+	src  string
+	root node
+}
+
+// ExprError reports a problem parsing an expression and the position of the
+// offending token.
+type ExprError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("%s at column %d\n  %s\n  %s^", e.Msg, e.Pos+1, e.Expr, strings.Repeat(" ", e.Pos))
+}
+
+// ParseExpr compiles src into an Expr.
+func ParseExpr(src string) (*Expr, error) {
+	p := &parser{src: src, lex: lexer{src: src}}
+	p.advance()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source text of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against a row; get returns the value of the
+// named column in that row.
+func (e *Expr) Eval(get func(column string) string) Value {
+	return e.root.eval(get)
+}
+
+// Match evaluates the expression as a condition.
+func (e *Expr) Match(get func(column string) string) bool {
+	return e.Eval(get).Bool()
+}
+
+// Columns returns the column names referenced by the expression.
+func (e *Expr) Columns() []string {
+	var cols []string
+	walk(e.root, func(n node) {
+		if c, ok := n.(columnNode); ok {
+			cols = append(cols, string(c))
+		}
+	})
+	return cols
+}
+
+// headerIndex maps each column name in header to its position.
+func headerIndex(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		if _, ok := index[h]; !ok {
+			index[h] = i
+		}
+	}
+	return index
+}
+
+// rowGetter returns a column lookup for record, suitable for Eval and Match.
+// Columns missing from the record read as empty.
+func rowGetter(index map[string]int, record []string) func(string) string {
+	return func(column string) string {
+		if i, ok := index[column]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+}
+
+type valueKind int
+
+const (
+	kindText valueKind = iota
+	kindNumber
+	kindBool
+	kindDate
+)
+
+// Value is the result of evaluating an expression. Text values read from
+// cells are interpreted as numbers or dates when compared or computed with.
+type Value struct {
+	kind  valueKind
+	text  string
+	num   float64
+	scale int // decimal places of a number, or -1 when unknown
+	b     bool
+	t     time.Time
+}
+
+func textValue(s string) Value               { return Value{kind: kindText, text: s} }
+func numberValue(n float64, scale int) Value { return Value{kind: kindNumber, num: n, scale: scale} }
+func boolValue(b bool) Value                 { return Value{kind: kindBool, b: b} }
+func dateValue(t time.Time) Value            { return Value{kind: kindDate, t: t} }
+
+// String formats the value as it would be written to a CSV cell.
+func (v Value) String() string {
+	switch v.kind {
+	case kindNumber:
+		return FormatNumber(v.num, v.scale)
+	case kindBool:
+		return strconv.FormatBool(v.b)
+	case kindDate:
+		return v.t.Format("2006-01-02")
+	}
+	return v.text
+}
+
+// Number returns the numeric interpretation of the value.
+func (v Value) Number() (float64, bool) {
+	n, _, ok := v.decimal()
+	return n, ok
+}
+
+// decimal returns the numeric interpretation of the value along with its
+// number of decimal places.
+func (v Value) decimal() (float64, int, bool) {
+	switch v.kind {
+	case kindNumber:
+		return v.num, v.scale, true
+	case kindText:
+		n, ok := ParseNumber(v.text)
+		return n, DecimalPlaces(v.text), ok
+	}
+	return 0, 0, false
+}
+
+// Date returns the date interpretation of the value.
+func (v Value) Date() (time.Time, bool) {
+	switch v.kind {
+	case kindDate:
+		return v.t, true
+	case kindText:
+		return ParseDate(v.text)
+	}
+	return time.Time{}, false
+}
+
+// Bool returns the truth of the value: text is true unless it is empty,
+// "false" or "0", and numbers are true unless zero.
+func (v Value) Bool() bool {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindNumber:
+		return v.num != 0
+	case kindDate:
+		return !v.t.IsZero()
+	}
+	s := strings.ToLower(strings.TrimSpace(v.text))
+	return s != "" && s != "false" && s != "0"
+}
+
+// compareValues orders a and b, returning -1, 0 or 1.
+func compareValues(a, b Value) int {
+	if x, ok := a.Number(); ok {
+		if y, ok := b.Number(); ok {
+			return compareOrdered(x, y)
+		}
+	}
+	if x, ok := a.Date(); ok {
+		if y, ok := b.Date(); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(a.String(), b.String())
+}
+
+func compareOrdered[T int | float64 | string](x, y T) int {
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+type node interface {
+	eval(get func(string) string) Value
+}
+
+type literalNode Value
+
+func (n literalNode) eval(func(string) string) Value { return Value(n) }
+
+type columnNode string
+
+func (n columnNode) eval(get func(string) string) Value { return textValue(get(string(n))) }
+
+type notNode struct{ x node }
+
+func (n notNode) eval(get func(string) string) Value { return boolValue(!n.x.eval(get).Bool()) }
+
+type logicalNode struct {
+	and  bool
+	l, r node
+}
+
+func (n logicalNode) eval(get func(string) string) Value {
+	l := n.l.eval(get).Bool()
+	if n.and && !l || !n.and && l {
+		return boolValue(l)
+	}
+	return boolValue(n.r.eval(get).Bool())
+}
+
+type compareNode struct {
+	op   string
+	l, r node
+}
+
+func (n compareNode) eval(get func(string) string) Value {
+	c := compareValues(n.l.eval(get), n.r.eval(get))
+	switch n.op {
+	case "=", "==":
+		return boolValue(c == 0)
+	case "!=", "<>":
+		return boolValue(c != 0)
+	case "<":
+		return boolValue(c < 0)
+	case "<=":
+		return boolValue(c <= 0)
+	case ">":
+		return boolValue(c > 0)
+	}
+	return boolValue(c >= 0)
+}
+
+type matchNode struct {
+	negate bool
+	l      node
+	re     *regexp.Regexp
+}
+
+func (n matchNode) eval(get func(string) string) Value {
+	return boolValue(n.re.MatchString(n.l.eval(get).String()) != n.negate)
+}
+
+type arithmeticNode struct {
+	op   byte
+	l, r node
+}
+
+// eval applies the operator to the numeric interpretation of both sides.
+// Empty cells count as zero so that, e.g., Credit - Debit works when one of
+// the two is blank; any other non-numeric operand yields an empty result.
+func (n arithmeticNode) eval(get func(string) string) Value {
+	x, xs, ok := operand(n.l.eval(get))
+	if !ok {
+		return textValue("")
+	}
+	y, ys, ok := operand(n.r.eval(get))
+	if !ok {
+		return textValue("")
+	}
+	switch n.op {
+	case '+':
+		return numberValue(x+y, maxScale(xs, ys))
+	case '-':
+		return numberValue(x-y, maxScale(xs, ys))
+	case '*':
+		if xs < 0 || ys < 0 {
+			return numberValue(x*y, -1)
+		}
+		return numberValue(x*y, xs+ys)
+	}
+	if y == 0 {
+		return textValue("")
+	}
+	return numberValue(roundTo(x/y, 10), -1)
+}
+
+func operand(v Value) (float64, int, bool) {
+	if v.kind == kindText && strings.TrimSpace(v.text) == "" {
+		return 0, 0, true
+	}
+	return v.decimal()
+}
+
+func maxScale(a, b int) int {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type callNode struct {
+	f    function
+	args []node
+}
+
+func (n callNode) eval(get func(string) string) Value {
+	args := make([]Value, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.eval(get)
+	}
+	return n.f.call(args)
+}
+
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case notNode:
+		walk(n.x, fn)
+	case logicalNode:
+		walk(n.l, fn)
+		walk(n.r, fn)
+	case compareNode:
+		walk(n.l, fn)
+		walk(n.r, fn)
+	case matchNode:
+		walk(n.l, fn)
+	case arithmeticNode:
+		walk(n.l, fn)
+		walk(n.r, fn)
+	case callNode:
+		for _, arg := range n.args {
+			walk(arg, fn)
+		}
+	}
+}
+
+type parser struct {
+	src string
+	lex lexer
+	tok token
+}
+
+func (p *parser) advance() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &ExprError{Expr: p.src, Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("or", "||") {
+		p.advance()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = logicalNode{and: false, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("and", "&&") {
+		p.advance()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = logicalNode{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.tok.is("not", "!") {
+		p.advance()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		return l, nil
+	}
+	switch op := p.tok.text; op {
+	case "=", "==", "!=", "<>", "<", "<=", ">", ">=":
+		p.advance()
+		r, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{op: op, l: l, r: r}, nil
+	case "~", "!~":
+		p.advance()
+		if p.tok.kind != tokString {
+			return nil, p.errorf("expected a quoted regular expression after %q, found %s", op, p.tok)
+		}
+		re, err := regexp.Compile(p.tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid regular expression: %v", err)
+		}
+		p.advance()
+		return matchNode{negate: op == "!~", l: l, re: re}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("+", "-") {
+		op := p.tok.text
+		p.advance()
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = arithmeticNode{op: op[0], l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseProduct() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("*", "/") {
+		op := p.tok.text
+		p.advance()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = arithmeticNode{op: op[0], l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.is("-") {
+		p.advance()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if lit, ok := x.(literalNode); ok && lit.kind == kindNumber {
+			return literalNode(numberValue(-lit.num, lit.scale)), nil
+		}
+		return arithmeticNode{op: '-', l: literalNode(numberValue(0, 0)), r: x}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.tok
+	switch {
+	case t.kind == tokString:
+		p.advance()
+		return literalNode(textValue(t.text)), nil
+	case t.kind == tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", t.text)
+		}
+		p.advance()
+		return literalNode(numberValue(n, DecimalPlaces(t.text))), nil
+	case t.is("true", "false"):
+		p.advance()
+		return literalNode(boolValue(strings.EqualFold(t.text, "true"))), nil
+	case t.kind == tokIdent:
+		p.advance()
+		if p.tok.is("(") {
+			return p.parseCall(t)
+		}
+		return columnNode(t.text), nil
+	case t.kind == tokColumn:
+		p.advance()
+		return columnNode(t.text), nil
+	case t.is("("):
+		p.advance()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.tok.is(")") {
+			return nil, p.errorf("expected ')', found %s", p.tok)
+		}
+		p.advance()
+		return x, nil
+	case t.kind == tokError:
+		return nil, p.errorf("%s", t.text)
+	}
+	return nil, p.errorf("unexpected %s", t)
+}
+
+// parseCall parses the argument list of a call to the function named by fn.
+func (p *parser) parseCall(fn token) (node, error) {
+	f, ok := functions[strings.ToLower(fn.text)]
+	if !ok {
+		return nil, &ExprError{Expr: p.src, Pos: fn.pos, Msg: fmt.Sprintf("unknown function %q", fn.text)}
+	}
+	p.advance()
+	var args []node
+	for !p.tok.is(")") {
+		if len(args) > 0 {
+			if !p.tok.is(",") {
+				return nil, p.errorf("expected ',' or ')', found %s", p.tok)
+			}
+			p.advance()
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) < f.min || f.max >= 0 && len(args) > f.max {
+		return nil, p.errorf("%s expects %s, got %d", fn.text, f.arity(), len(args))
+	}
+	p.advance()
+	return callNode{f: f, args: args}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokError
+	tokIdent
+	tokColumn
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// is reports whether the token is one of the given operators or keywords.
+func (t token) is(texts ...string) bool {
+	if t.kind != tokOp && t.kind != tokIdent {
+		return false
+	}
+	for _, s := range texts {
+		if strings.EqualFold(t.text, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string '%s'", t.text)
+	case tokColumn:
+		return fmt.Sprintf("column [%s]", t.text)
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+// operators are matched longest first.
+var operators = []string{"==", "!=", "<>", "<=", ">=", "!~", "&&", "||", "=", "<", ">", "~", "!", "(", ")", ",", "+", "-", "*", "/"}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t') {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+	c := l.src[l.pos]
+	switch {
+	case c == '\'' || c == '"':
+		end := strings.IndexByte(l.src[l.pos+1:], c)
+		if end < 0 {
+			l.pos = len(l.src)
+			return token{kind: tokError, text: "unterminated string", pos: start}
+		}
+		l.pos += end + 2
+		return token{kind: tokString, text: l.src[start+1 : l.pos-1], pos: start}
+	case c == '[':
+		end := strings.IndexByte(l.src[l.pos:], ']')
+		if end < 0 {
+			l.pos = len(l.src)
+			return token{kind: tokError, text: "unterminated column name", pos: start}
+		}
+		l.pos += end + 1
+		return token{kind: tokColumn, text: l.src[start+1 : l.pos-1], pos: start}
+	case c >= '0' && c <= '9' || c == '.':
+		for l.pos < len(l.src) && (l.src[l.pos] >= '0' && l.src[l.pos] <= '9' || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}
+	case isIdentByte(c):
+		for l.pos < len(l.src) && (isIdentByte(l.src[l.pos]) || l.src[l.pos] >= '0' && l.src[l.pos] <= '9') {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}
+		}
+	}
+	l.pos++
+	return token{kind: tokError, text: fmt.Sprintf("unexpected character %q", c), pos: start}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
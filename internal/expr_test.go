@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"testing"
+)
+
+func TestExprMatch(t *testing.T) {
+	header := []string{"Date", "Category", "Amount", "Transaction Date", "Description"}
+	record := []string{"01/15/2024", "Grocery", "$1,250.00", "20240115", "AMZN Mktp US*1234"}
+	var tests = []struct {
+		expr string
+		want bool
+	}{
+		{"Category != 'Transfer' and Amount > 100", true},
+		{"Category = 'Transfer' or Amount > 100", true},
+		{"Category == \"Grocery\" && Amount < 100", false},
+		{"not (Amount >= 1250)", false},
+		{"!(Amount <> 1250)", true},
+		{"Amount > -5", true},
+		{"Date >= '2024-01-01' and Date < '2024-02-01'", true},
+		{"Date > '2024-01-15'", false},
+		{"[Transaction Date] = 20240115", true},
+		{"Description ~ '^AMZN'", true},
+		{"Description !~ '(?i)amzn'", false},
+		{"Missing = ''", true},
+		{"Category", true},
+	}
+	index := headerIndex(header)
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.Match(rowGetter(index, record)); got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprParseError(t *testing.T) {
+	var tests = []struct {
+		expr string
+		pos  int
+	}{
+		{"Amount > ", 9},
+		{"Category != 'Transfer", 12},
+		{"Amount > 100 and )", 17},
+		{"(Amount > 100", 13},
+		{"Description ~ Memo", 14},
+		{"Description ~ '('", 14},
+		{"Amount # 3", 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseExpr(tt.expr)
+			var exprErr *ExprError
+			if !errors.As(err, &exprErr) {
+				t.Fatalf("got %v, want an *ExprError", err)
+			}
+			if exprErr.Pos != tt.pos {
+				t.Errorf("got position %d, want %d: %v", exprErr.Pos, tt.pos, err)
+			}
+		})
+	}
+}
+
+func TestCombineWhere(t *testing.T) {
+	where, err := ParseExpr("Amount > 30 and Category != 'Dining'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Merger{Where: where}
+	files := []string{"../cmd/fixtures/transactions.CSV"}
+	w := bytes.NewBufferString("")
+	m.combine(csv.NewWriter(w), files, nil)
+
+	expected := `Transaction Date,Post Date,Category,Amount
+20230115,2023,Grocery,68.77
+`
+	if w.String() != expected {
+		t.Errorf("TestCombineWhere got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+}
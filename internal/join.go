@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "golang.org/x/exp/slog"
+)
+
+const DefaultJoinFile = "joined.csv"
+
+// JoinTypes are the kinds of join accepted by Join.Type.
+var JoinTypes = []string{"inner", "left", "right", "full"}
+
+// Join matches the rows of two files on key columns. Rows of the left file
+// without a match are kept by left and full joins, those of the right file by
+// right and full joins. Blank keys never match.
+type Join struct {
+	Type     string
+	LeftKey  []string
+	RightKey []string
+	// LeftPrefix and RightPrefix are prepended to the names of non-key
+	// columns found in both files; by default the file name followed by "_".
+	LeftPrefix  string
+	RightPrefix string
+}
+
+// ParseJoinKeys reads key columns written as NAME, for columns named alike
+// in both files, or LEFT=RIGHT.
+func ParseJoinKeys(on []string) (left, right []string) {
+	for _, k := range on {
+		l, r, found := strings.Cut(k, "=")
+		if !found {
+			r = l
+		}
+		left = append(left, strings.TrimSpace(l))
+		right = append(right, strings.TrimSpace(r))
+	}
+	return left, right
+}
+
+// joinSide is one of the two files of a join, its columns as written by
+// fileScan.output.
+type joinSide struct {
+	file   string
+	header []string
+	key    []int // positions of the key columns
+	rest   []int // positions of the other columns
+	outer  bool  // keep rows without a match
+}
+
+func (m *Merger) joinSide(file string, key []string, outer bool) (*joinSide, error) {
+	s := m.scan(file, nil)
+	defer s.close()
+	if err := s.requireColumns(key...); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	side := &joinSide{file: file, header: s.outputNames(), outer: outer}
+	index := headerIndex(side.header)
+	isKey := make(map[int]bool)
+	for _, k := range key {
+		i, ok := index[k]
+		if !ok {
+			return nil, fmt.Errorf("%s: key column %q is not selected", file, k)
+		}
+		side.key = append(side.key, i)
+		isKey[i] = true
+	}
+	for i := range side.header {
+		if !isKey[i] {
+			side.rest = append(side.rest, i)
+		}
+	}
+	return side, nil
+}
+
+// joinSides checks j and reads the headers of the left and right files.
+func (m *Merger) joinSides(left, right string, j Join) (*joinSide, *joinSide, error) {
+	if len(j.LeftKey) == 0 || len(j.LeftKey) != len(j.RightKey) {
+		return nil, nil, fmt.Errorf("join needs the same number of key columns on both sides")
+	}
+	known := false
+	for _, t := range JoinTypes {
+		known = known || t == j.Type
+	}
+	if !known {
+		return nil, nil, fmt.Errorf("unknown join type %q, use one of %s", j.Type, strings.Join(JoinTypes, ", "))
+	}
+	l, err := m.joinSide(left, j.LeftKey, j.Type == "left" || j.Type == "full")
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := m.joinSide(right, j.RightKey, j.Type == "right" || j.Type == "full")
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
+
+func (side *joinSide) keyOf(row []string) (string, bool) {
+	values := make([]string, len(side.key))
+	for i, k := range side.key {
+		if strings.TrimSpace(row[k]) == "" {
+			return "", false
+		}
+		values[i] = row[k]
+	}
+	return strings.Join(values, "\x1f"), true
+}
+
+func (side *joinSide) restOf(row []string) []string {
+	values := make([]string, len(side.rest))
+	if row != nil {
+		for i, c := range side.rest {
+			values[i] = row[c]
+		}
+	}
+	return values
+}
+
+// JoinCSVFiles joins the rows of the left and right files and writes them to
+// the output file, which is left alone when the join can't be made.
+func (m *Merger) JoinCSVFiles(left, right string, j Join, outputFilename *string) error {
+	l, r, err := m.joinSides(left, right, j)
+	if err != nil {
+		return err
+	}
+	if outputFilename == nil {
+		name := DefaultJoinFile
+		outputFilename = &name
+	}
+	f := m.outputFile(outputFilename)
+	defer closeFile(f)
+
+	cw := csv.NewWriter(f)
+	if err := m.join(cw, l, r, j); err != nil {
+		return err
+	}
+	fmt.Printf("%v <- %s, %s\n", m.OutputFileName, left, right)
+	return nil
+}
+
+// join is a hash join: the rows of the smaller file are loaded into a table
+// keyed on the join columns and the larger file is streamed past it.
+// Duplicates and transfers are looked for across both files.
+func (m *Merger) join(w *csv.Writer, l, r *joinSide, j Join) error {
+	m.admission = m.admitAcross([]string{l.file, r.file})
+	defer func() {
+		m.admission.close()
+		m.admission = nil
+	}()
+	writeLine(w, joinHeader(l, r, j))
+
+	build, probe := l, r
+	if fileSize(l.file) > fileSize(r.file) {
+		build, probe = r, l
+	}
+	log.Debug("join", "type", j.Type, "build", build.file, "probe", probe.file)
+
+	type entry struct {
+		row     []string
+		matched bool
+	}
+	table := make(map[string][]*entry)
+	var all []*entry
+	s := m.scan(build.file, nil)
+	m.eachAdmitted(s, func(record []string) {
+		e := &entry{row: s.output(record)}
+		all = append(all, e)
+		if k, ok := build.keyOf(e.row); ok {
+			table[k] = append(table[k], e)
+		}
+	})
+	s.close()
+
+	emit := func(buildRow, probeRow []string) {
+		if build == l {
+			writeLine(w, joinRow(l, r, buildRow, probeRow))
+		} else {
+			writeLine(w, joinRow(l, r, probeRow, buildRow))
+		}
+	}
+	s = m.scan(probe.file, nil)
+	m.eachAdmitted(s, func(record []string) {
+		row := s.output(record)
+		k, ok := probe.keyOf(row)
+		matches := table[k]
+		if !ok || len(matches) == 0 {
+			if probe.outer {
+				emit(nil, row)
+			}
+			return
+		}
+		for _, e := range matches {
+			e.matched = true
+			emit(e.row, row)
+		}
+	})
+	s.close()
+
+	if build.outer {
+		for _, e := range all {
+			if !e.matched {
+				emit(e.row, nil)
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// joinHeader names the output columns: the key columns, then the other
+// columns of the left and right files, prefixed where both files have them.
+func joinHeader(l, r *joinSide, j Join) []string {
+	leftPrefix, rightPrefix := j.LeftPrefix, j.RightPrefix
+	if leftPrefix == "" {
+		leftPrefix = baseName(l.file) + "_"
+	}
+	if rightPrefix == "" {
+		rightPrefix = baseName(r.file) + "_"
+	}
+	names := make(map[string]int)
+	for _, side := range []*joinSide{l, r} {
+		for _, c := range side.rest {
+			names[side.header[c]]++
+		}
+	}
+	var header []string
+	for _, k := range l.key {
+		header = append(header, l.header[k])
+	}
+	for _, side := range []*joinSide{l, r} {
+		prefix := leftPrefix
+		if side == r {
+			prefix = rightPrefix
+		}
+		for _, c := range side.rest {
+			name := side.header[c]
+			if names[name] > 1 {
+				name = prefix + name
+			}
+			header = append(header, name)
+		}
+	}
+	return header
+}
+
+// joinRow builds an output row from a left and a right row, either of which
+// is nil for an unmatched row of an outer join.
+func joinRow(l, r *joinSide, left, right []string) []string {
+	var row []string
+	for i := range l.key {
+		if left != nil {
+			row = append(row, left[l.key[i]])
+		} else {
+			row = append(row, right[r.key[i]])
+		}
+	}
+	row = append(row, l.restOf(left)...)
+	return append(row, r.restOf(right)...)
+}
+
+func baseName(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+}
+
+func fileSize(file string) int64 {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	left, right := "../cmd/fixtures/test.csv", "../cmd/fixtures/accounts.csv"
+	var tests = []struct {
+		typ  string
+		want string
+	}{
+		// accounts.csv is the larger file, so it is streamed and sets the order.
+		{"inner", `ssn,test_first_name,last_name,accounts_first_name,account
+123456,John,Barry,John,CHK-1
+687987,Kathy,Smith,Kathy,SAV-2
+123456,John,Barry,John,CARD-3
+`},
+		{"left", `ssn,test_first_name,last_name,accounts_first_name,account
+123456,John,Barry,John,CHK-1
+687987,Kathy,Smith,Kathy,SAV-2
+123456,John,Barry,John,CARD-3
+3979870,Bob,McCornick,,
+`},
+		{"right", `ssn,test_first_name,last_name,accounts_first_name,account
+123456,John,Barry,John,CHK-1
+687987,Kathy,Smith,Kathy,SAV-2
+555555,,,Zed,CHK-9
+123456,John,Barry,John,CARD-3
+`},
+		{"full", `ssn,test_first_name,last_name,accounts_first_name,account
+123456,John,Barry,John,CHK-1
+687987,Kathy,Smith,Kathy,SAV-2
+555555,,,Zed,CHK-9
+123456,John,Barry,John,CARD-3
+3979870,Bob,McCornick,,
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			w := bytes.NewBufferString("")
+			err := joinFiles(new(Merger), csv.NewWriter(w), left, right, Join{Type: tt.typ, LeftKey: []string{"ssn"}, RightKey: []string{"ssn"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinKeysAndPrefixes(t *testing.T) {
+	l, r := ParseJoinKeys([]string{"ssn", "first_name=first_name"})
+	w := bytes.NewBufferString("")
+	err := joinFiles(new(Merger), csv.NewWriter(w), "../cmd/fixtures/accounts.csv", "../cmd/fixtures/test.csv",
+		Join{Type: "inner", LeftKey: l, RightKey: r, LeftPrefix: "a.", RightPrefix: "b."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `ssn,first_name,account,last_name
+123456,John,CHK-1,Barry
+687987,Kathy,SAV-2,Smith
+123456,John,CARD-3,Barry
+`
+	if w.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", w.String(), want)
+	}
+
+	for _, j := range []Join{{Type: "cross", LeftKey: l, RightKey: r}, {Type: "inner", LeftKey: []string{"id"}, RightKey: []string{"id"}}} {
+		if err := joinFiles(new(Merger), csv.NewWriter(w), "../cmd/fixtures/accounts.csv", "../cmd/fixtures/test.csv", j); err == nil {
+			t.Errorf("expected an error for %v", j)
+		}
+	}
+}
+
+func TestJoinDedupe(t *testing.T) {
+	m := &Merger{Dedupe: &Dedupe{Key: []string{"ssn"}}}
+	w := bytes.NewBufferString("")
+	err := joinFiles(m, csv.NewWriter(w), "../cmd/fixtures/test.csv", "../cmd/fixtures/accounts.csv", Join{Type: "full", LeftKey: []string{"ssn"}, RightKey: []string{"ssn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the accounts of the people in test.csv duplicate them on ssn
+	want := `ssn,test_first_name,last_name,accounts_first_name,account
+555555,,,Zed,CHK-9
+123456,John,Barry,,
+687987,Kathy,Smith,,
+3979870,Bob,McCornick,,
+`
+	if w.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", w.String(), want)
+	}
+}
+
+func TestJoinCSVFilesKeepsOutput(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "joined.csv")
+	if err := os.WriteFile(output, []byte("kept\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := new(Merger).JoinCSVFiles("../cmd/fixtures/test.csv", "../cmd/fixtures/accounts.csv", Join{Type: "inner", LeftKey: []string{"id"}, RightKey: []string{"id"}}, &output)
+	if err == nil {
+		t.Fatal("expected an error for a missing key column")
+	}
+	if got, _ := os.ReadFile(output); string(got) != "kept\n" {
+		t.Errorf("output changed to %q", got)
+	}
+}
+
+func joinFiles(m *Merger, w *csv.Writer, left, right string, j Join) error {
+	l, r, err := m.joinSides(left, right, j)
+	if err != nil {
+		return err
+	}
+	return m.join(w, l, r, j)
+}
@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// layoutSample is the number of lines read to detect the header row.
+const layoutSample = 50
+
+// FooterPattern matches the first cell of summary lines at the end of bank
+// exports, such as "Total" or "Closing balance". Lines holding a date are
+// taken as data even when they match, as "Total Wine & More" would.
+var FooterPattern = regexp.MustCompile(`(?i)^\s*(totals?|sub-?totals?|sum|closing balance|ending balance|end of)\b`)
+
+// Layout says where the header and the data of an input file are. Bank
+// exports often start with lines of account details before the header and
+// end with total lines; by default the header is detected as the first line
+// shaped like the data that follows it, and footer lines are trimmed when
+// asked to.
+type Layout struct {
+	// HeaderRow is the line number, from 1 and not counting blank lines,
+	// of the header; 0 to use SkipUntil or detect it.
+	HeaderRow int
+	// SkipUntil, when set, makes the header the first line matching it.
+	SkipUntil *regexp.Regexp
+	// TrimFooter drops the trailing lines that look like totals.
+	TrimFooter bool
+	// NoHeader lists the files without a header line, keyed by path, base
+	// name or "*" for every file, with the names of their columns. Columns
+	// left unnamed are called col1, col2 and so on by position.
+	NoHeader map[string][]string
+}
+
+// plain reports whether l asks for nothing but the defaults, in which case a
+// plain merge copies files as they are.
+func (l Layout) plain() bool {
+	return l.HeaderRow == 0 && l.SkipUntil == nil && !l.TrimFooter && len(l.NoHeader) == 0
+}
+
+// openLayout opens src, the content of file, as laid out by m.Layout. Each
+// footer line trimmed is reported once on stderr.
+func (m *Merger) openLayout(file string, src io.Reader) *layoutReader {
+	lr := m.Layout.open(file, src)
+	if !m.quiet {
+		lr.dropped = m.reportFooter
+	}
+	return lr
+}
+
+func (m *Merger) reportFooter(file string, line []string) {
+	key := file + "\x00" + strings.Join(line, "\x00")
+	if m.footers[key] {
+		return
+	}
+	if m.footers == nil {
+		m.footers = make(map[string]bool)
+	}
+	m.footers[key] = true
+	fmt.Fprintf(os.Stderr, "footer: %s: dropped %s\n", file, strings.Join(line, ","))
+}
+
+// ParseNoHeader reads headerless files written as FILE or FILE=NAME,NAME,...
+func ParseNoHeader(specs []string) (map[string][]string, error) {
+	files := make(map[string][]string)
+	for _, s := range specs {
+		file, names, found := strings.Cut(s, "=")
+		file = strings.TrimSpace(file)
+		if file == "" {
+			return nil, fmt.Errorf("no header %q: expected FILE or FILE=NAME,NAME,...", s)
+		}
+		files[file] = nil
+		if !found {
+			continue
+		}
+		for _, n := range strings.Split(names, ",") {
+			if n = strings.TrimSpace(n); n == "" {
+				return nil, fmt.Errorf("no header %q: empty column name", s)
+			}
+			files[file] = append(files[file], n)
+		}
+	}
+	return files, nil
+}
+
+// headerless returns the column names given for file and whether it has no
+// header line.
+func (l Layout) headerless(file string) ([]string, bool) {
+	for _, k := range []string{file, filepath.Base(file), "*"} {
+		if names, ok := l.NoHeader[k]; ok {
+			return names, true
+		}
+	}
+	return nil, false
+}
+
+// positionalHeader returns names followed by col<N> for the remaining
+// columns of a file width columns wide.
+func positionalHeader(names []string, width int) []string {
+	header := append([]string{}, names...)
+	for i := len(header); i < width; i++ {
+		header = append(header, fmt.Sprintf("col%d", i+1))
+	}
+	return header
+}
+
+// layoutReader reads the data lines of a file laid out as described by a
+// Layout, after its header.
+type layoutReader struct {
+	r        *csv.Reader
+	file     string
+	layout   Layout
+	header   []string
+	width    int        // the number of non-empty cells of the header
+	buffered [][]string // lines read while finding the header
+	pending  [][]string // footer-like lines held back until a data line follows
+	ready    [][]string
+	started  bool
+	// dropped, when set, is told of each footer line trimmed
+	dropped func(file string, line []string)
+}
+
+// read returns the next line of the file, without the byte order mark some
+// programs write at its start.
+func (lr *layoutReader) read() ([]string, bool) {
+	line, ok := readline(lr.r)
+	if ok && !lr.started && len(line) > 0 {
+		line[0] = strings.TrimPrefix(line[0], "\ufeff")
+	}
+	lr.started = true
+	return line, ok
+}
+
+// uniqueHeader returns header with repeated names made unique by a suffix,
+// e.g. Amount, Amount_2, so that every column can be selected. The first
+// column of a name keeps it, and names already in header are not reused.
+// Blank names are left as they are.
+func uniqueHeader(header []string) []string {
+	taken := make(map[string]bool, len(header))
+	for _, h := range header {
+		taken[h] = true
+	}
+	seen := make(map[string]bool, len(header))
+	unique := make([]string, len(header))
+	for i, h := range header {
+		unique[i] = h
+		if h == "" || !seen[h] {
+			seen[h] = true
+			continue
+		}
+		for n := 2; ; n++ {
+			name := fmt.Sprintf("%s_%d", h, n)
+			if !taken[name] {
+				unique[i] = name
+				taken[name] = true
+				break
+			}
+		}
+	}
+	return unique
+}
+
+// open reads src, the content of file, up to and including its header, which
+// is nil when src has no lines. The header of a headerless file is made up
+// and its first line kept as data.
+func (l Layout) open(file string, src io.Reader) *layoutReader {
+	lr := &layoutReader{r: csv.NewReader(src), file: file, layout: l}
+	lr.r.FieldsPerRecord = -1
+
+	var lines [][]string
+	h := 0
+	if names, ok := l.headerless(file); ok {
+		line, ok := lr.read()
+		if !ok {
+			return lr
+		}
+		lr.header = uniqueHeader(positionalHeader(names, len(line)))
+		lr.width = nonEmpty(lr.header)
+		lr.buffered = [][]string{line}
+		return lr
+	}
+	switch {
+	case l.HeaderRow > 0:
+		for len(lines) < l.HeaderRow {
+			line, ok := lr.read()
+			if !ok {
+				return lr
+			}
+			lines = append(lines, line)
+		}
+		h = l.HeaderRow - 1
+	case l.SkipUntil != nil:
+		for {
+			line, ok := lr.read()
+			if !ok {
+				return lr
+			}
+			if l.SkipUntil.MatchString(strings.Join(line, ",")) {
+				lines = append(lines, line)
+				break
+			}
+		}
+	default:
+		for len(lines) < layoutSample {
+			line, ok := lr.read()
+			if !ok {
+				break
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			return lr
+		}
+		h = detectHeader(lines)
+	}
+	lr.header = uniqueHeader(lines[h])
+	lr.width = nonEmpty(lr.header)
+	lr.buffered = lines[h+1:]
+	return lr
+}
+
+// detectHeader returns the position among lines of the header: the first
+// line at least as wide as most lines whose cells are all text. When the
+// first such wide line holds numbers or dates, the file has no preamble and
+// the first line is taken as usual.
+func detectHeader(lines [][]string) int {
+	counts := make(map[int]int)
+	common := 0
+	for _, line := range lines {
+		w := rowWidth(line)
+		counts[w]++
+		if counts[w] > counts[common] || counts[w] == counts[common] && w > common {
+			common = w
+		}
+	}
+	for i, line := range lines {
+		if rowWidth(line) < common || nonEmpty(line) < 2 && common > 1 {
+			continue
+		}
+		if textLine(line) {
+			return i
+		}
+		break
+	}
+	return 0
+}
+
+// rowWidth returns the position after the last non-empty cell of line.
+func rowWidth(line []string) int {
+	for i := len(line) - 1; i >= 0; i-- {
+		if strings.TrimSpace(line[i]) != "" {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func nonEmpty(line []string) int {
+	n := 0
+	for _, c := range line {
+		if strings.TrimSpace(c) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// textLine reports whether no cell of line is a number or a date.
+func textLine(line []string) bool {
+	for _, c := range line {
+		if _, ok := ParseNumber(c); ok {
+			return false
+		}
+		if _, ok := ParseDate(c); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// footerLike reports whether line may be part of a footer: a total line, or
+// a line of a single cell in a file of several columns, holding no date.
+func (lr *layoutReader) footerLike(line []string) bool {
+	for _, c := range line {
+		if _, ok := ParseDate(c); ok {
+			return false
+		}
+	}
+	for _, c := range line {
+		if strings.TrimSpace(c) != "" {
+			return FooterPattern.MatchString(c) || nonEmpty(line) == 1 && lr.width > 2
+		}
+	}
+	return false
+}
+
+func (lr *layoutReader) raw() ([]string, bool) {
+	if len(lr.buffered) > 0 {
+		line := lr.buffered[0]
+		lr.buffered = lr.buffered[1:]
+		return line, true
+	}
+	return lr.read()
+}
+
+// next returns the next data line. With TrimFooter, footer-like lines are
+// held back and dropped when nothing but footer-like lines follows them.
+func (lr *layoutReader) next() ([]string, bool) {
+	if lr.header == nil {
+		return nil, false
+	}
+	for {
+		if len(lr.ready) > 0 {
+			line := lr.ready[0]
+			lr.ready = lr.ready[1:]
+			return line, true
+		}
+		line, ok := lr.raw()
+		if !ok {
+			if lr.dropped != nil {
+				for _, l := range lr.pending {
+					lr.dropped(lr.file, l)
+				}
+			}
+			lr.pending = nil
+			return nil, false
+		}
+		if !lr.layout.TrimFooter {
+			return line, true
+		}
+		if lr.footerLike(line) {
+			lr.pending = append(lr.pending, line)
+			continue
+		}
+		lr.ready = append(lr.pending, line)
+		lr.pending = nil
+	}
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDetectHeader(t *testing.T) {
+	var tests = []struct {
+		name  string
+		lines [][]string
+		want  int
+	}{
+		{"plain", [][]string{{"Date", "Amount"}, {"2024-01-02", "1.00"}, {"2024-01-03", "2.00"}}, 0},
+		{"preamble", [][]string{{"Account:", "1234"}, {"Date", "Description", "Amount"}, {"2024-01-02", "x", "1.00"}, {"2024-01-03", "y", "2.00"}}, 1},
+		{"single cell preamble", [][]string{{"Statement"}, {"", "", ""}, {"Date", "Memo", "Amount"}, {"2024-01-02", "x", "1.00"}}, 2},
+		{"no header", [][]string{{"2024-01-02", "x", "1.00"}, {"2024-01-03", "y", "2.00"}}, 0},
+		{"one column", [][]string{{"Name"}, {"Alice"}, {"Bob"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectHeader(tt.lines); got != tt.want {
+				t.Errorf("detectHeader() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutOpen(t *testing.T) {
+	const src = `Account Name:,Everyday Checking
+Statement Period:,January
+
+Date,Description,Amount
+2024-01-02,COFFEE,-4.50
+Subtotal,,-4.50
+2024-01-05,PAYROLL,2000.00
+Total,,1995.50
+Closing balance,,1995.50
+`
+	var tests = []struct {
+		name   string
+		layout Layout
+		header []string
+		rows   int
+	}{
+		{"detected", Layout{}, []string{"Date", "Description", "Amount"}, 5},
+		{"trim footer", Layout{TrimFooter: true}, []string{"Date", "Description", "Amount"}, 3},
+		{"header row", Layout{HeaderRow: 3, TrimFooter: true}, []string{"Date", "Description", "Amount"}, 3},
+		{"skip until", Layout{SkipUntil: regexp.MustCompile(`^Date,`), TrimFooter: true}, []string{"Date", "Description", "Amount"}, 3},
+		{"first line", Layout{HeaderRow: 1}, []string{"Account Name:", "Everyday Checking"}, 7},
+		{"no match", Layout{SkipUntil: regexp.MustCompile(`^Posted`)}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.layout.open("export.csv", strings.NewReader(src))
+			if !reflect.DeepEqual(r.header, tt.header) {
+				t.Errorf("header = %q, want %q", r.header, tt.header)
+			}
+			rows := 0
+			for _, ok := r.next(); ok; _, ok = r.next() {
+				rows++
+			}
+			if rows != tt.rows {
+				t.Errorf("%d rows, want %d", rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestTrimFooter(t *testing.T) {
+	const src = `Date,Description,Amount,Memo
+2024-01-02,COFFEE,-4.50,
+Total Wine & More,-38.00,2024-01-02,
+Carol,,,
+Total,,-42.50,
+`
+	r := Layout{TrimFooter: true}.open("export.csv", strings.NewReader(src))
+	var dropped []string
+	r.dropped = func(file string, line []string) {
+		dropped = append(dropped, file+": "+strings.Join(line, ","))
+	}
+	rows := 0
+	for _, ok := r.next(); ok; _, ok = r.next() {
+		rows++
+	}
+	if rows != 2 {
+		t.Errorf("%d rows, want 2", rows)
+	}
+	if want := []string{"export.csv: Carol,,,", "export.csv: Total,,-42.50,"}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("dropped %q, want %q", dropped, want)
+	}
+}
+
+func TestMergePlain(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "merged.csv")
+	file := "../cmd/fixtures/bank_export.csv"
+	new(Merger).Merge([]string{file}, &out)
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every line is kept, blank lines aside as ever
+	want = bytes.ReplaceAll(bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n")), []byte("\n\n"), []byte("\n"))
+	if !bytes.Equal(got, want) {
+		t.Errorf("a plain merge changed the file:\n%s", got)
+	}
+}
+
+func TestHeadersLayout(t *testing.T) {
+	got := new(Merger).Headers([]string{"../cmd/fixtures/bank_export.csv", "../cmd/fixtures/statement_jan.csv"})
+	want := []string{"Date", "Description", "Amount", "Balance"}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("Headers() = %q, want %q", got[0], want)
+	}
+	if first := Headers([]string{"../cmd/fixtures/bank_export.csv"}); first[0][0] != "Account Name:" {
+		t.Errorf("Headers() = %q, want the first line", first[0])
+	}
+}
+
+func TestParseNoHeader(t *testing.T) {
+	got, err := ParseNoHeader([]string{"dump.csv", "other.csv=Date, Amount"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"dump.csv": nil, "other.csv": {"Date", "Amount"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNoHeader() = %q, want %q", got, want)
+	}
+	for _, spec := range []string{"=Date", "dump.csv=Date,,Amount"} {
+		if _, err := ParseNoHeader([]string{spec}); err == nil {
+			t.Errorf("ParseNoHeader(%q) should fail", spec)
+		}
+	}
+}
+
+func TestCombineNoHeader(t *testing.T) {
+	var tests = []struct {
+		name     string
+		noHeader map[string][]string
+		columns  []string
+		expected string
+	}{
+		{"positional", map[string][]string{"*": nil}, []string{"col1", "col3"},
+			"col1,col3\n2024-01-03,-52.10\n2024-01-04,-38.00\n2024-01-06,12.00\n"},
+		{"named", map[string][]string{"dump.csv": {"Date", "Description"}}, []string{"Date", "col3"},
+			"Date,col3\n2024-01-03,-52.10\n2024-01-04,-38.00\n2024-01-06,12.00\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Merger{Layout: Layout{NoHeader: tt.noHeader}}
+			w := bytes.NewBufferString("")
+			m.combine(csv.NewWriter(w), []string{"../cmd/fixtures/dump.csv"}, tt.columns)
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestUniqueHeader(t *testing.T) {
+	var tests = []struct {
+		header, want []string
+	}{
+		{[]string{"Date", "Amount"}, []string{"Date", "Amount"}},
+		{[]string{"Date", "Amount", "Amount", "Amount"}, []string{"Date", "Amount", "Amount_2", "Amount_3"}},
+		{[]string{"Amount", "Amount", "Amount_2"}, []string{"Amount", "Amount_3", "Amount_2"}},
+		{[]string{"", "", "x"}, []string{"", "", "x"}},
+	}
+	for _, tt := range tests {
+		if got := uniqueHeader(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uniqueHeader(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// LookupModes are the ways a row's value can match a reference key.
+var LookupModes = []string{"exact", "icase", "prefix", "contains", "regex"}
+
+// Lookup enriches rows with columns of a reference table, e.g. the Category
+// of a merchant. A row's Key column is matched against the table's RefKey
+// column according to Mode:
+//
+//	exact     the values are equal
+//	icase     the values are equal ignoring case and surrounding space
+//	prefix    the row's value starts with the key, ignoring case; the
+//	          longest key wins
+//	contains  the row's value contains the key, ignoring case; the longest
+//	          key wins
+//	regex     the key is a regular expression matching the row's value;
+//	          the first matching key in the table wins
+//
+// The Columns of the matching reference row are copied into the row. A row
+// without a match keeps the values it already has.
+type Lookup struct {
+	File    string
+	RefKey  string
+	Key     string
+	Columns []string
+	Mode    string
+
+	exact   map[string][]string
+	entries []lookupEntry
+}
+
+type lookupEntry struct {
+	key    string
+	re     *regexp.Regexp
+	values []string
+}
+
+// ParseLookup reads a lookup written as FILE:REFKEY=KEY:COLUMNS[:MODE], e.g.
+//
+//	merchants.csv:Merchant=Description:Category,Tags:prefix
+//
+// where REFKEY=KEY may be a single name when the columns are named alike,
+// and loads the reference table. The spec is read from the right and MODE
+// is known by name, so FILE may hold colons, as in C:\ref\merchants.csv.
+func ParseLookup(spec string) (*Lookup, error) {
+	l := &Lookup{Mode: "exact"}
+	rest := spec
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		for _, mode := range LookupModes {
+			if strings.EqualFold(rest[i+1:], mode) {
+				l.Mode, rest = mode, rest[:i]
+				break
+			}
+		}
+	}
+	columns := strings.LastIndex(rest, ":")
+	keys := -1
+	if columns > 0 {
+		keys = strings.LastIndex(rest[:columns], ":")
+	}
+	if keys <= 0 {
+		return nil, fmt.Errorf("lookup %q: expected FILE:REFKEY=KEY:COLUMNS[:MODE]", spec)
+	}
+	l.File = rest[:keys]
+	l.RefKey, l.Key, _ = strings.Cut(rest[keys+1:columns], "=")
+	l.RefKey, l.Key = strings.TrimSpace(l.RefKey), strings.TrimSpace(l.Key)
+	if l.Key == "" {
+		l.Key = l.RefKey
+	}
+	for _, c := range strings.Split(rest[columns+1:], ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			l.Columns = append(l.Columns, c)
+		}
+	}
+	if err := l.Load(); err != nil {
+		return nil, fmt.Errorf("lookup %q: %w", spec, err)
+	}
+	return l, nil
+}
+
+// Load reads the reference table from File.
+func (l *Lookup) Load() error {
+	known := false
+	for _, mode := range LookupModes {
+		known = known || mode == l.Mode
+	}
+	if !known {
+		return fmt.Errorf("unknown mode %q, use one of %s", l.Mode, strings.Join(LookupModes, ", "))
+	}
+	f, err := os.Open(l.File)
+	if err != nil {
+		return err
+	}
+	defer closeFile(f)
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%s is empty", l.File)
+	}
+	refKey := 0
+	cols := make([]int, len(l.Columns))
+	for i, c := range append([]string{l.RefKey}, l.Columns...) {
+		found := ColumnIndexes(records[0], []string{c})
+		if len(found) == 0 {
+			return fmt.Errorf("column %q not found in %s: %v", c, l.File, records[0])
+		}
+		if i == 0 {
+			refKey = found[0]
+		} else {
+			cols[i-1] = found[0]
+		}
+	}
+
+	l.exact = make(map[string][]string)
+	l.entries = nil
+	for n, rec := range records[1:] {
+		e := lookupEntry{key: rec[refKey], values: make([]string, len(cols))}
+		for i, c := range cols {
+			e.values[i] = rec[c]
+		}
+		switch l.Mode {
+		case "exact", "icase":
+			k := l.normalize(e.key)
+			if _, dup := l.exact[k]; !dup {
+				l.exact[k] = e.values
+			}
+		case "regex":
+			if e.re, err = regexp.Compile(e.key); err != nil {
+				return fmt.Errorf("%s line %d: %w", l.File, n+2, err)
+			}
+			l.entries = append(l.entries, e)
+		default:
+			e.key = strings.ToLower(e.key)
+			l.entries = append(l.entries, e)
+		}
+	}
+	return nil
+}
+
+func (l *Lookup) normalize(s string) string {
+	if l.Mode == "icase" {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+	return s
+}
+
+// Find returns the Columns of the reference row matching value.
+func (l *Lookup) Find(value string) ([]string, bool) {
+	switch l.Mode {
+	case "exact", "icase":
+		values, ok := l.exact[l.normalize(value)]
+		return values, ok
+	case "regex":
+		for _, e := range l.entries {
+			if e.re.MatchString(value) {
+				return e.values, true
+			}
+		}
+		return nil, false
+	}
+	value = strings.ToLower(value)
+	var best *lookupEntry
+	for i, e := range l.entries {
+		hit := l.Mode == "prefix" && strings.HasPrefix(value, e.key) ||
+			l.Mode == "contains" && strings.Contains(value, e.key)
+		if hit && e.key != "" && (best == nil || len(e.key) > len(best.key)) {
+			best = &l.entries[i]
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best.values, true
+}
+
+// applyLookups fills in the lookup columns of row, whose columns are
+// positioned by index, matching each lookup on the column at that position
+// of keys, or on a blank value when it is -1.
+func applyLookups(index map[string]int, row []string, lookups []*Lookup, keys []int) {
+	for i, l := range lookups {
+		key := ""
+		if keys[i] >= 0 {
+			key = row[keys[i]]
+		}
+		values, ok := l.Find(key)
+		if !ok {
+			continue
+		}
+		for j, c := range l.Columns {
+			row[index[c]] = values[j]
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupFind(t *testing.T) {
+	var tests = []struct {
+		spec  string
+		value string
+		want  string
+		found bool
+	}{
+		{"../cmd/fixtures/merchants.csv:Merchant=Description:Category", "Coffee", "Dining", true},
+		{"../cmd/fixtures/merchants.csv:Merchant=Description:Category", "Rent", "", false},
+		{"../cmd/fixtures/merchants.csv:Merchant=Description:Category:icase", " RENT ", "Housing", true},
+		{"../cmd/fixtures/merchants.csv:Merchant=Description:Category:prefix", "Payroll ACME", "Income", true},
+		{"../cmd/fixtures/merchants.csv:Merchant=Description:Category:contains", "Monthly rent Jan", "Housing", true},
+		{"../cmd/fixtures/merchants.csv:Merchant=Description:Category:regex", "Coffee Shop", "Dining", true},
+		{"../cmd/fixtures/merchants.csv:Merchant=Description:Category:regex", "coffee", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+"|"+tt.value, func(t *testing.T) {
+			l, err := ParseLookup(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, found := l.Find(tt.value)
+			if found != tt.found || found && values[0] != tt.want {
+				t.Errorf("Find(%q) = %v, %v, want %q, %v", tt.value, values, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestParseLookupError(t *testing.T) {
+	for _, spec := range []string{
+		"../cmd/fixtures/merchants.csv:Merchant",
+		"../cmd/fixtures/missing.csv:Merchant=Description:Category",
+		"../cmd/fixtures/merchants.csv:Vendor=Description:Category",
+		"../cmd/fixtures/merchants.csv:Merchant=Description:Category:fuzzy",
+	} {
+		if _, err := ParseLookup(spec); err == nil {
+			t.Errorf("ParseLookup(%q) should fail", spec)
+		}
+	}
+}
+
+func TestParseLookupPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "C:ref")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile("../cmd/fixtures/merchants.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "merchants.csv")
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range []string{file + ":merchant=Description:category", file + ":Merchant=Description:Category,Tags:icase"} {
+		l, err := ParseLookup(spec)
+		if err != nil {
+			t.Fatalf("ParseLookup(%q): %v", spec, err)
+		}
+		if l.File != file || l.Key != "Description" {
+			t.Errorf("ParseLookup(%q) = %+v", spec, l)
+		}
+	}
+}
+
+func TestCombineLookup(t *testing.T) {
+	l, err := ParseLookup("../cmd/fixtures/merchants.csv:Merchant=description:Category,Tags:icase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, _ := ParseExpr("Category != ''")
+	m := &Merger{Lookups: []*Lookup{l}, Where: where}
+	w := bytes.NewBufferString("")
+	m.combine(csv.NewWriter(w), []string{"../cmd/fixtures/statement_jan.csv"}, []string{"Description", "Category", "Tags"})
+
+	expected := `Description,Category,Tags
+Coffee,Dining,daily
+Rent,Housing,fixed
+`
+	if w.String() != expected {
+		t.Errorf("TestCombineLookup got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+}
@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultMatchThreshold is the score from which a column proposed for a
+// missing one is accepted without asking, and minSuggestScore the score
+// below which it is not proposed at all.
+const (
+	DefaultMatchThreshold = 0.8
+	minSuggestScore       = 0.4
+)
+
+// matchSample is the number of data lines read to tell what a column holds.
+const matchSample = 20
+
+// ColumnMatch is a column of a file proposed for a selected column the file
+// lacks, e.g. "Trans Date" for "Transaction Date".
+type ColumnMatch struct {
+	File     string
+	Column   string // the selected column
+	Source   string // the file's column
+	Score    float64
+	Accepted bool
+}
+
+func (c ColumnMatch) String() string {
+	if c.Accepted {
+		return fmt.Sprintf("columns: %s: reading %q as %q (%.2f)\n", c.File, c.Source, c.Column, c.Score)
+	}
+	return fmt.Sprintf("columns: %s has no %q, the closest is %q (%.2f)\n", c.File, c.Column, c.Source, c.Score)
+}
+
+// FuzzyMatch configures the matching of selected columns a file lacks to
+// similarly named columns of the file.
+type FuzzyMatch struct {
+	// Threshold is the score, between 0 and 1, a column needs to be taken
+	// without asking; above 1 nothing is taken.
+	Threshold float64
+	// Confirm, when set, is asked about columns scoring below Threshold,
+	// best first, until it accepts one.
+	Confirm func(ColumnMatch) bool
+}
+
+// columnProfile is a file's header with the kind of value each column holds.
+type columnProfile struct {
+	file    string
+	header  []string
+	kinds   []valueKind
+	known   []bool     // a kind could be told from the sample
+	samples [][]string // the first distinct non-blank values of each column
+}
+
+// profileSamples is the number of values of each column kept by profile.
+const profileSamples = 3
+
+// MatchColumns looks, in each of files lacking one of columns, for a column
+// named similarly and holding the same kind of values, and records the ones
+// accepted as aliases in m.Aliases, so that they are read as the selected
+// column. It returns the columns accepted and those proposed but refused.
+func (m *Merger) MatchColumns(files []string, columns []string, f FuzzyMatch) []ColumnMatch {
+	profiles := make([]columnProfile, len(files))
+	kinds := make(map[string]valueKind) // normalized column name -> kind
+	for i, file := range files {
+		profiles[i] = m.profile(file)
+		for j, h := range profiles[i].header {
+			key := NormalizeHeader(h)
+			if _, ok := kinds[key]; !ok && profiles[i].known[j] {
+				kinds[key] = profiles[i].kinds[j]
+			}
+		}
+	}
+
+	var matches []ColumnMatch
+	for _, p := range profiles {
+		candidates := m.columnCandidates(p, columns, kinds)
+		taken := make(map[string]bool)
+		asked := make(map[string]bool)
+		for _, c := range candidates {
+			if taken[c.Source] || asked[c.Column] || m.hasColumn(p.header, c.Column) {
+				continue
+			}
+			switch {
+			case c.Score >= f.Threshold:
+				c.Accepted = true
+			case f.Confirm != nil:
+				c.Accepted = f.Confirm(c)
+			default:
+				asked[c.Column] = true
+			}
+			if c.Accepted {
+				m.addAlias(c.Column, c.Source)
+				taken[c.Source], asked[c.Column] = true, true
+			}
+			if c.Accepted || f.Confirm == nil {
+				matches = append(matches, c)
+			}
+		}
+	}
+	return matches
+}
+
+// profile reads the header of file and a sample of its rows.
+func (m *Merger) profile(file string) columnProfile {
+	src := openFile(file)
+	defer closeFile(src)
+	r := m.openLayout(file, src)
+	p := columnProfile{file: file, header: r.header}
+	p.samples = make([][]string, len(r.header))
+	counts := make([]map[valueKind]int, len(r.header))
+	for i := range counts {
+		counts[i] = make(map[valueKind]int)
+	}
+	for n := 0; n < matchSample; n++ {
+		line, ok := r.next()
+		if !ok {
+			break
+		}
+		for i, cell := range line {
+			if i >= len(counts) || strings.TrimSpace(cell) == "" {
+				continue
+			}
+			counts[i][cellKind(cell)]++
+			if len(p.samples[i]) < profileSamples && !contains(p.samples[i], cell) {
+				p.samples[i] = append(p.samples[i], cell)
+			}
+		}
+	}
+	p.kinds = make([]valueKind, len(r.header))
+	p.known = make([]bool, len(r.header))
+	for i, c := range counts {
+		best := 0
+		for k, n := range c {
+			if n > best || n == best && k < p.kinds[i] {
+				p.kinds[i], best = k, n
+			}
+		}
+		p.known[i] = best > 0
+	}
+	return p
+}
+
+// cellKind tells whether a cell holds a date, a number or text.
+func cellKind(cell string) valueKind {
+	if _, ok := ParseDate(cell); ok {
+		return kindDate
+	}
+	if _, ok := ParseNumber(cell); ok {
+		return kindNumber
+	}
+	return kindText
+}
+
+// hasColumn reports whether header has column, spelled in any way matched
+// by NormalizeHeader or through an alias.
+func (m *Merger) hasColumn(header []string, column string) bool {
+	names := append([]string{column}, m.Aliases[column]...)
+	for _, h := range header {
+		for _, n := range names {
+			if NormalizeHeader(h) == NormalizeHeader(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// columnCandidates returns the columns of p that might stand for one of
+// columns p lacks, best first.
+func (m *Merger) columnCandidates(p columnProfile, columns []string, kinds map[string]valueKind) []ColumnMatch {
+	// columns of the file already selected, under any spelling, are not
+	// proposed for another
+	used := make(map[string]bool)
+	for _, c := range columns {
+		used[NormalizeHeader(c)] = true
+		for _, a := range m.Aliases[c] {
+			used[NormalizeHeader(a)] = true
+		}
+	}
+	var candidates []ColumnMatch
+	for _, c := range columns {
+		if m.hasColumn(p.header, c) {
+			continue
+		}
+		kind, known := kinds[NormalizeHeader(c)]
+		for i, h := range p.header {
+			if h == "" || used[NormalizeHeader(h)] {
+				continue
+			}
+			// the name counts for most, the kind of values for the rest
+			score := 0.8 * nameSimilarity(c, h)
+			switch {
+			case !known || !p.known[i]:
+				score += 0.1
+			case kind == p.kinds[i]:
+				score += 0.2
+			}
+			if score >= minSuggestScore {
+				candidates = append(candidates, ColumnMatch{File: p.file, Column: c, Source: h, Score: roundTo(score, 2)})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	return candidates
+}
+
+// addAlias records that source is read as column.
+func (m *Merger) addAlias(column, source string) {
+	if m.Aliases == nil {
+		m.Aliases = make(map[string][]string)
+	}
+	for _, a := range m.Aliases[column] {
+		if a == source {
+			return
+		}
+	}
+	m.Aliases[column] = append(m.Aliases[column], source)
+}
+
+// nameSimilarity scores, between 0 and 1, how alike two column names are:
+// the mean of their edit distance and of the share of their words in
+// common, where a word matches its abbreviations ("Trans", "Amt").
+func nameSimilarity(a, b string) float64 {
+	a, b = NormalizeHeader(a), NormalizeHeader(b)
+	if a == b {
+		return 1
+	}
+	longest := len([]rune(a))
+	if n := len([]rune(b)); n > longest {
+		longest = n
+	}
+	edit := 1 - float64(editDistance(a, b))/float64(longest)
+
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	matched := make([]bool, len(wb))
+	common := 0
+	for _, x := range wa {
+		for j, y := range wb {
+			if !matched[j] && abbreviates(x, y) {
+				matched[j] = true
+				common++
+				break
+			}
+		}
+	}
+	words := 0.0
+	if n := len(wa) + len(wb) - common; n > 0 {
+		words = float64(common) / float64(n)
+	}
+	return (edit + words) / 2
+}
+
+// abbreviates reports whether one of the words x and y is the other or an
+// abbreviation of it: 3 letters or more, starting with its first letter and
+// followed by some of its other letters in order, e.g. "trans" or "amt".
+func abbreviates(x, y string) bool {
+	if len(x) > len(y) {
+		x, y = y, x
+	}
+	if x == y {
+		return true
+	}
+	if len(x) < 3 || x[0] != y[0] {
+		return false
+	}
+	i := 1
+	for j := 1; j < len(y) && i < len(x); j++ {
+		if y[j] == x[i] {
+			i++
+		}
+	}
+	return i == len(x)
+}
+
+// editDistance returns the Levenshtein distance of a and b, in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"amount", "", 6},
+		{"kitten", "sitting", 3},
+		{"date", "date", 0},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAbbreviates(t *testing.T) {
+	var tests = []struct {
+		x, y string
+		want bool
+	}{
+		{"trans", "transaction", true},
+		{"amt", "amount", true},
+		{"desc", "description", true},
+		{"date", "description", false},
+		{"to", "total", false},
+		{"a", "amount", false},
+	}
+	for _, tt := range tests {
+		if got := abbreviates(tt.x, tt.y); got != tt.want {
+			t.Errorf("abbreviates(%q, %q) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	if got := nameSimilarity("Transaction Date", "transaction_date"); got != 1 {
+		t.Errorf("equal names scored %v", got)
+	}
+	close, far := nameSimilarity("Transaction Date", "Trans. Date"), nameSimilarity("Transaction Date", "Posting Date")
+	if close <= far {
+		t.Errorf("Trans. Date scored %v, Posting Date %v", close, far)
+	}
+}
+
+func TestMatchColumns(t *testing.T) {
+	files := []string{"../cmd/fixtures/transactions.CSV", "../cmd/fixtures/card_export.csv"}
+	columns := []string{"Transaction Date", "Category", "Amount"}
+	var tests = []struct {
+		name    string
+		f       FuzzyMatch
+		want    []ColumnMatch
+		aliases map[string][]string
+	}{
+		{"batch", FuzzyMatch{Threshold: DefaultMatchThreshold}, []ColumnMatch{
+			{files[1], "Transaction Date", "Trans. Date", 0.85, true},
+			{files[1], "Amount", "Amt", 0.8, true},
+		}, map[string][]string{"Transaction Date": {"Trans. Date"}, "Amount": {"Amt"}}},
+		{"high threshold", FuzzyMatch{Threshold: 0.82}, []ColumnMatch{
+			{files[1], "Transaction Date", "Trans. Date", 0.85, true},
+			{files[1], "Amount", "Amt", 0.8, false},
+		}, map[string][]string{"Transaction Date": {"Trans. Date"}}},
+		{"confirm", FuzzyMatch{Threshold: 2, Confirm: func(c ColumnMatch) bool { return c.Source == "Amt" }}, []ColumnMatch{
+			{files[1], "Amount", "Amt", 0.8, true},
+		}, map[string][]string{"Amount": {"Amt"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(Merger)
+			got := m.MatchColumns(files, columns, tt.f)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MatchColumns() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(m.Aliases, tt.aliases) {
+				t.Errorf("Aliases = %v, want %v", m.Aliases, tt.aliases)
+			}
+		})
+	}
+}
+
+func TestCombineAliases(t *testing.T) {
+	m := &Merger{Unified: true, Aliases: map[string][]string{"Transaction Date": {"Trans. Date"}, "Amount": {"Amt"}}}
+	w := bytes.NewBufferString("")
+	m.combine(csv.NewWriter(w), []string{"../cmd/fixtures/card_export.csv"}, []string{"Transaction Date", "Amount"})
+	expected := "Transaction Date,Amount\n20230203,45.10\n20230210,12.99\n"
+	if w.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	log "golang.org/x/exp/slog"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -17,6 +18,56 @@ type Merger struct {
 	OutputFileName string
 	GenerateConfig bool
 	NegateColumns  []string
+	// Computed columns are evaluated for every row before Where and column
+	// selection, so they can be filtered on and selected like any other column.
+	Computed []Computed
+	// Lookups add the columns of matching reference table rows, after the
+	// computed columns are evaluated.
+	Lookups []*Lookup
+	// Currency, when set, converts amounts to a single currency, after the
+	// lookups.
+	Currency *Conversion
+	// Categories, when set, fills in the category and tags of each row from
+	// an ordered rule list, after the lookups.
+	Categories *Categorizer
+	// Where, when set, keeps only the data rows for which the expression holds.
+	Where *Expr
+	// Dedupe, when set, drops rows duplicating another row of the input.
+	Dedupe *Dedupe
+	// Transfers, when set, tags (or drops) the pairs of rows moving money
+	// between the accounts of different input files.
+	Transfers *Transfers
+	// Unified writes a single header row followed by the rows of every file
+	// aligned to it, instead of each file's own header and rows.
+	Unified bool
+	// Sort orders the merged rows; it implies Unified.
+	Sort []SortKey
+	// SortChunkRows is the number of rows sorted in memory before spilling to
+	// a temp file; DefaultSortChunkRows when zero.
+	SortChunkRows int
+	// Balance adds a running balance to each row written; it implies
+	// Unified.
+	Balance *RunningBalance
+	// Layout locates the header and data lines of each input file.
+	Layout Layout
+	// Select picks the columns of each file written to the output, among
+	// the selected columns if any.
+	Select *ColumnSelection
+	// Rename gives output names to columns, and Order lists the columns,
+	// by output or input name, written first.
+	Rename map[string]string
+	Order  []string
+	// Aliases lists, by selected column, other names the column goes by in
+	// some files; see MatchColumns.
+	Aliases map[string][]string
+	// OriginalHeaders writes column names as spelled in the input files
+	// rather than as spelled in the selected columns; see NormalizeHeader.
+	OriginalHeaders bool
+
+	unified   []string        // the output header of a unified combine in progress
+	quiet     bool            // combine prints neither progress nor reports
+	footers   map[string]bool // the footer lines reported, by file and line
+	admission *admission      // the first pass of a command reading files one by one
 }
 
 func (m *Merger) Merge(filenames []string, outputFilename *string) {
@@ -36,55 +87,309 @@ func (m *Merger) CombineCSVFiles(filenames []string, cols []string, outputFilena
 }
 
 func (m *Merger) combine(w *csv.Writer, files []string, columns []string) {
-	//first try at this will be a naive impl:
-	// 1. read in records of each input file, write columns with matching headers; load everything into memory
+	// Rows are streamed from each input file to the writer one at a time, so
+	// memory use does not grow with the size of the input.
 	log.Debug("columns to keep", "columns", columns)
 	log.Debug("columns to negate", "negate", m.NegateColumns)
-
-	// Build a set of column names to negate for quick lookup
-	negateSet := make(map[string]bool)
-	for _, col := range m.NegateColumns {
-		negateSet[col] = true
+	if m.Where != nil {
+		log.Debug("row filter", "where", m.Where)
 	}
 
-	for _, f := range files {
-		reader := csv.NewReader(openFile(f))
-		records, _ := reader.ReadAll()
-		rows := make([][]string, len(records))
-		indexes := ColumnIndexes(records[0], columns)
-
-		for i := 0; i < len(records); i++ {
-			var cols []string
-			for _, col := range indexes {
-				value := records[i][col]
-				// Apply negation if this column is in the negate list and it's not the header row
-				if i > 0 && negateSet[records[0][col]] {
-					value = NegateValue(value)
-				}
-				cols = append(cols, value) //the columns we are using in the output file
+	m.unified = nil
+	var b *balancer
+	var p projection
+	if m.Unified || len(m.Sort) > 0 || m.Balance != nil {
+		m.unified = m.OutputHeader(files, columns)
+		defer func() { m.unified = nil }()
+		header := m.unified
+		if m.OriginalHeaders {
+			header = m.spelled(files, header)
+		}
+		p = m.project(m.unified, header)
+		header = p.header
+		if m.Balance != nil {
+			var err error
+			if b, err = newBalancer(m.unified, *m.Balance); err != nil {
+				LogPanic("", err)
 			}
-			rows[i] = append(rows[i], cols...) //the rows for this file
+			header = append(append([]string{}, header...), m.Balance.Columns()...)
 		}
+		writeLine(w, header)
+	}
 
-		err := w.WriteAll(rows)
-		if err != nil {
+	d, t := m.firstPass(files, columns)
+	if d != nil {
+		defer d.close()
+	}
+
+	var sorter *externalSorter
+	if len(m.Sort) > 0 {
+		sorter = m.newSorter()
+		defer sorter.close()
+	}
+
+	// With a running balance per file, the file a row comes from travels
+	// through the sorter as an extra last cell.
+	tagFile := b != nil && sorter != nil && b.opts.ByFile
+	emit := func(row []string, file int) {
+		if b != nil {
+			row = b.apply(row, file)
+		}
+		writeLine(w, p.apply(row))
+	}
+
+	seq := 0
+	for i, f := range files {
+		s := m.scan(f, columns)
+		if s.header != nil && m.unified == nil {
+			p = m.project(s.outputNames(), s.outputHeader())
+			writeLine(w, p.header)
+		}
+		for record, ok := s.next(); ok; record, ok = s.next() {
+			seq++
+			if !s.admit(d, t, seq-1, record) {
+				continue
+			}
+			switch {
+			case tagFile:
+				sorter.add(append(s.output(record), strconv.Itoa(i)))
+			case sorter != nil:
+				sorter.add(s.output(record))
+			default:
+				emit(s.output(record), i)
+			}
+		}
+		s.close()
+		w.Flush()
+		if err := w.Error(); err != nil {
 			LogPanic("", err)
 		}
+		if !m.quiet {
+			fmt.Printf("%v <- %s\n", m.OutputFileName, f)
+		}
+	}
+	if sorter != nil {
+		sorter.each(func(row []string) {
+			file := 0
+			if tagFile {
+				file, _ = strconv.Atoi(row[len(row)-1])
+				row = row[:len(row)-1]
+			}
+			emit(row, file)
+		})
 		w.Flush()
-		fmt.Printf("%v <- %s\n", m.OutputFileName, f)
 	}
-	m.GenerateConfigFile(columns)
+	if m.quiet {
+		return
+	}
+	if d != nil {
+		fmt.Print(d.report)
+	}
+	if t != nil {
+		fmt.Print(t.report())
+	}
+	if m.Currency != nil {
+		fmt.Print(m.Currency.Report())
+	}
+	if m.Categories != nil {
+		fmt.Print(m.Categories.Report())
+	}
+	if b != nil {
+		fmt.Print(b.report())
+	}
+	m.GenerateConfigFile(m.Config(columns))
+
+}
+
+// eachRow calls fn with every data row of files that passes the row pipeline
+// (computed columns, lookups, currency, categories, Where, Dedupe,
+// Transfers, negation), aligned to columns, along with the index of the file it was
+// read from.
+func (m *Merger) eachRow(files []string, columns []string, fn func(file int, row []string)) {
+	m.unified = columns
+	defer func() { m.unified = nil }()
+
+	d, t := m.firstPass(files, columns)
+	if d != nil {
+		defer d.close()
+	}
+
+	seq := 0
+	for i, f := range files {
+		s := m.scan(f, columns)
+		for record, ok := s.next(); ok; record, ok = s.next() {
+			if s.admit(d, t, seq, record) {
+				fn(i, s.output(record))
+			}
+			seq++
+		}
+		s.close()
+	}
+}
+
+// admission is the first pass over the input files of a command reading them
+// one at a time, such as pivot or join, rather than in order like combine.
+type admission struct {
+	d     *deduper
+	t     *transferMatcher
+	start map[string]int // position of the first row of each file
+}
+
+// admitAcross runs the first pass over files, looking for duplicates and
+// transfers across all of them.
+func (m *Merger) admitAcross(files []string) *admission {
+	d, t := m.firstPass(files, nil)
+	a := &admission{d: d, t: t, start: make(map[string]int)}
+	if d == nil && t == nil {
+		return a
+	}
+	seq := 0
+	for _, f := range files {
+		if _, ok := a.start[f]; !ok {
+			a.start[f] = seq
+		}
+		s := m.scan(f, nil)
+		for _, ok := s.next(); ok; _, ok = s.next() {
+			seq++
+		}
+		s.close()
+	}
+	return a
+}
+
+func (a *admission) close() {
+	if a.d != nil {
+		a.d.close()
+	}
+}
+
+// eachAdmitted calls fn with every data row of s that passes the row
+// pipeline, Dedupe and Transfers included. Duplicates and transfers are
+// looked for across the files of the admission in progress, if any, or else
+// within the file of s alone.
+func (m *Merger) eachAdmitted(s *fileScan, fn func(record []string)) {
+	a := m.admission
+	if a == nil {
+		a = m.admitAcross([]string{s.file})
+		defer a.close()
+	}
+	seq := a.start[s.file]
+	for record, ok := s.next(); ok; record, ok = s.next() {
+		if s.admit(a.d, a.t, seq, record) {
+			fn(record)
+		}
+		seq++
+	}
+}
+
+// firstPass reads files ahead of a combine when rows depend on rows of other
+// files: to find duplicates and transfers. Either result is nil when not
+// asked for.
+func (m *Merger) firstPass(files []string, columns []string) (*deduper, *transferMatcher) {
+	var d *deduper
+	var t *transferMatcher
+	if m.Dedupe != nil {
+		d = m.findDuplicates(files, columns)
+	}
+	if m.Transfers != nil {
+		t = m.findTransfers(files, columns, d)
+	}
+	if m.Currency != nil {
+		m.Currency.resetStats()
+	}
+	if m.Categories != nil {
+		m.Categories.resetStats()
+	}
+	return d, t
+}
+
+// admit reports whether the row at position seq, the row last returned by
+// next, is written, filling in its TransferID unless transfers are dropped.
+// The rows written are counted in the categories report.
+func (s *fileScan) admit(d *deduper, t *transferMatcher, seq int, record []string) bool {
+	if d != nil && !d.keep(seq) {
+		return false
+	}
+	if t != nil {
+		id := t.id(seq)
+		if t.opts.Drop && id != "" {
+			return false
+		}
+		if !t.opts.Drop {
+			record[s.index[TransferColumn]] = id
+		}
+	}
+	if s.m.Categories != nil {
+		s.m.Categories.count(s.category)
+	}
+	return true
+}
 
+// OutputHeader returns the header row of a unified combine of files: the
+// requested columns found in at least one file, or, when no columns are
+// requested, every column of every file in order of first appearance.
+func (m *Merger) OutputHeader(files []string, columns []string) []string {
+	found := make(map[string]bool)
+	keys := make(map[string]int) // normalized name -> the file adding it
+	var union []string
+	for i, f := range files {
+		s := m.scan(f, columns)
+		for _, col := range s.indexes {
+			h := s.header[col]
+			key := NormalizeHeader(h)
+			if file, ok := keys[key]; found[h] || ok && file != i {
+				continue
+			}
+			found[h], keys[key] = true, i
+			union = append(union, h)
+		}
+		s.close()
+	}
+	if columns == nil {
+		return union
+	}
+	var header []string
+	for _, col := range columns {
+		if found[col] {
+			header = append(header, col)
+			found[col] = false
+		}
+	}
+	return header
+}
+
+// spelled returns header spelled as in the first of files having each
+// column.
+func (m *Merger) spelled(files []string, header []string) []string {
+	spelled := append([]string{}, header...)
+	done := make([]bool, len(header))
+	for _, f := range files {
+		s := m.scan(f, header)
+		for i, h := range header {
+			if j, ok := s.index[h]; ok && !done[i] {
+				spelled[i], done[i] = s.spelled[j], true
+			}
+		}
+		s.close()
+	}
+	return spelled
 }
 
-// AppendCSVFiles appends the files in the array to the output file (writer)
+// AppendCSVFiles appends the files in the array to the output file (writer).
+// Every line is copied unless m.Layout asks to find the header or trim the
+// footer.
 func (m *Merger) AppendCSVFiles(w *csv.Writer, files []string) {
 	log.Debug("input files", "files", files)
 	for i := 0; i < len(files); i++ {
 		src := openFile(files[i])
-		csvSrc := csv.NewReader(src)
 
-		copyTo(csvSrc, w)
+		if m.Layout.plain() {
+			r := csv.NewReader(src)
+			r.FieldsPerRecord = -1
+			copyLines(r, w)
+		} else {
+			copyTo(m.openLayout(files[i], src), w)
+		}
 		closeFile(src)
 		w.Flush()
 		fmt.Printf("%v <- %s\n", m.OutputFileName, files[i])
@@ -111,21 +416,20 @@ func DeleteAndCreateFile(f string) *os.File {
 	return w
 }
 
-func (m *Merger) GenerateConfigFile(header []string) {
+func (m *Merger) GenerateConfigFile(c *Config) {
 	if !m.GenerateConfig {
 		return
 	}
 	enc := csv.NewWriter(DeleteAndCreateFile(OutputConfigFileName)) //Lazy here; client can't choose config file name
-	e := enc.Write(header)
-	if e != nil {
+	if e := enc.WriteAll(c.Records()); e != nil {
 		LogPanic("Unable to create config file.", e, "file", OutputConfigFileName)
 	}
-	enc.Flush()
 	fmt.Printf("generated %s\n", OutputConfigFileName)
 }
 
 func LoadConfigFile(f string) []string {
 	reader := csv.NewReader(openFile(f))
+	reader.FieldsPerRecord = -1 // the aliases row may be shorter
 	records, _ := reader.ReadAll()
 	return records[0]
 }
@@ -173,12 +477,24 @@ func writeLine(w *csv.Writer, line []string) {
 	}
 }
 
-func copyTo(r *csv.Reader, w *csv.Writer) {
+// copyLines writes every line of r.
+func copyLines(r *csv.Reader, w *csv.Writer) {
 	for line, b := readline(r); b; line, b = readline(r) {
 		writeLine(w, line)
 	}
 }
 
+// copyTo writes the header and data lines of r.
+func copyTo(r *layoutReader, w *csv.Writer) {
+	if r.header == nil {
+		return
+	}
+	writeLine(w, r.header)
+	for line, b := r.next(); b; line, b = r.next() {
+		writeLine(w, line)
+	}
+}
+
 // NegateValue converts a negative numeric string to its positive equivalent.
 // If the value starts with a minus sign, it removes the minus sign.
 // If the value is already positive or non-numeric, it returns the negated value.
@@ -196,5 +512,4 @@ func NegateValue(value string) string {
             return trimmed
         }
 	}
-	return value
 }
@@ -16,8 +16,8 @@ func init() {
 
 func TestCombine(t *testing.T) {
 	m := new(Merger)
-	files := []string{"../cmd/fixtures/test.csv", "../cmd/fixtures/transactions.CSV"}
-	headers := []string{"first_name", "ssn", "Transaction Date", "Category", "Amount", "Amount", "ssn"}
+	files := []string{"../cmd/fixtures/test.csv", "../cmd/fixtures/transactions.CSV", "../cmd/fixtures/split_amounts.csv"}
+	headers := []string{"first_name", "ssn", "Transaction Date", "Category", "Amount", "Amount", "ssn", "Amount_2"}
 	w := bytes.NewBufferString("")
 	m.combine(csv.NewWriter(w), files, headers)
 	//fmt.Print(w)
@@ -72,3 +72,29 @@ Date,Debit,Category
 		t.Errorf("TestCombineWithNegate got:\n%s\nwant:\n%s", w.String(), expected)
 	}
 }
+
+func TestCombineHeaderSpelling(t *testing.T) {
+	files := []string{"../cmd/fixtures/statement_mar.csv", "../cmd/fixtures/statement_jan.csv"}
+	var tests = []struct {
+		name     string
+		m        *Merger
+		columns  []string
+		expected string
+	}{
+		{"config spelling", &Merger{}, []string{"Date", "Amount"},
+			"Date,Amount\n2024-03-01,-23.40\n2024-03-04,2000.00\nDate,Amount\n2024-01-30,-4.50\n2024-01-31,2000.00\n2024-02-01,-1200.00\n"},
+		{"original spelling", &Merger{OriginalHeaders: true}, []string{"Date", "Amount"},
+			"date,amount \n2024-03-01,-23.40\n2024-03-04,2000.00\nDate,Amount\n2024-01-30,-4.50\n2024-01-31,2000.00\n2024-02-01,-1200.00\n"},
+		{"unified", &Merger{Unified: true}, nil,
+			"date,DESCRIPTION,amount ,Balance\n2024-03-01,Bookstore,-23.40,1772.10\n2024-03-04,Payroll,2000.00,3772.10\n2024-01-30,Coffee,-4.50,995.50\n2024-01-31,Payroll,2000.00,2995.50\n2024-02-01,Rent,-1200.00,1795.50\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := bytes.NewBufferString("")
+			tt.m.combine(csv.NewWriter(w), files, tt.columns)
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%q\nwant:\n%q", w.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeHeader reduces a column name to a key for matching names spelled
+// differently: the name is put in Unicode normalization form NFKC, so that
+// composed and decomposed accents, and full-width letters and digits, read
+// alike; case is folded, a byte order mark is dropped, and runs of spaces,
+// punctuation and underscores become one space. "Transaction_Date",
+// " transaction date" and "TRANSACTION-DATE" all read "transaction date".
+func NormalizeHeader(name string) string {
+	var sb strings.Builder
+	gap := false
+	for _, r := range norm.NFKC.String(name) {
+		if r == '\ufeff' {
+			continue
+		}
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			gap = true
+			continue
+		}
+		if gap && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		gap = false
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// dateLayouts are the date formats recognised in bank and ledger exports, most
+// specific first.
+var dateLayouts = []string{
+	"2006-01-02",
+	"20060102",
+	"01/02/2006",
+	"1/2/2006",
+	"01/02/06",
+	"1/2/06",
+	"2006/01/02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2 Jan 2006",
+	"02-Jan-2006",
+}
+
+// ParseNumber reads an amount as it appears in a CSV cell. Currency symbols,
+// thousands separators and surrounding whitespace are ignored and accounting
+// style negatives, e.g. "(12.50)", are supported.
+func ParseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	s = strings.NewReplacer("$", "", "€", "", "£", "", ",", "", " ", "").Replace(s)
+	if strings.HasSuffix(s, "-") {
+		negative = !negative
+		s = strings.TrimSuffix(s, "-")
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		n = -n
+	}
+	return n, true
+}
+
+// DecimalPlaces returns the number of digits after the decimal point in s.
+func DecimalPlaces(s string) int {
+	s = strings.TrimRight(strings.TrimSpace(s), ")-")
+	if i := strings.LastIndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// FormatNumber writes n with the given number of decimal places, or in its
+// shortest form when places is negative.
+func FormatNumber(n float64, places int) string {
+	if places < 0 {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(n, 'f', places, 64)
+}
+
+// ParseDate reads a date in any of the layouts in dateLayouts.
+func ParseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNumber(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  float64
+		ok    bool
+	}{
+		{"12.36", 12.36, true},
+		{" -50.00 ", -50, true},
+		{"$1,250.00", 1250, true},
+		{"(12.50)", -12.5, true},
+		{"25.00-", -25, true},
+		{"€3", 3, true},
+		{"", 0, false},
+		{"text", 0, false},
+		{"2024-01-01", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := ParseNumber(tt.input)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ParseNumber(%q) = %v, %v, want %v, %v", tt.input, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	want := time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)
+	for _, input := range []string{"2023-01-15", "20230115", "01/15/2023", "1/15/2023", "2023/01/15", "Jan 15, 2023", "15 Jan 2023"} {
+		t.Run(input, func(t *testing.T) {
+			got, ok := ParseDate(input)
+			if !ok || !got.Equal(want) {
+				t.Errorf("ParseDate(%q) = %v, %v, want %v", input, got, ok, want)
+			}
+		})
+	}
+	if _, ok := ParseDate("Merchandise"); ok {
+		t.Errorf("ParseDate(%q) should fail", "Merchandise")
+	}
+}
+
+func TestNormalizeHeader(t *testing.T) {
+	var tests = []struct {
+		input, want string
+	}{
+		{"Amount", "amount"},
+		{" AMOUNT ", "amount"},
+		{"Transaction_Date", "transaction date"},
+		{"transaction  -  date", "transaction date"},
+		{"\ufeffDate", "date"},
+		{"ＡＭＯＵＮＴ", "amount"},
+		{"Caf\u00e9", "caf\u00e9"},  // composed
+		{"Cafe\u0301", "caf\u00e9"}, // decomposed
+		{"\ufb01le", "file"},        // ligature
+		{"Amount ($)", "amount $"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := NormalizeHeader(tt.input); got != tt.want {
+				t.Errorf("NormalizeHeader(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
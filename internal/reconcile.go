@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultReconcileDir is where reconcile writes its output files.
+const DefaultReconcileDir = "reconciled"
+
+// The files written by reconcile.
+const (
+	ReconcileMatchedFile        = "matched.csv"
+	ReconcileUnmatchedLeftFile  = "unmatched_left.csv"
+	ReconcileUnmatchedRightFile = "unmatched_right.csv"
+)
+
+// Reconcile matches the records of two files, e.g. a ledger and a bank
+// export. Records match when their amounts are equal and their dates at most
+// Days apart; among several candidates the one with the most similar
+// description, then the closest date, wins. Each record is matched at most
+// once.
+type Reconcile struct {
+	Days                              int
+	LeftDate, RightDate               string
+	LeftAmount, RightAmount           string
+	LeftDescription, RightDescription string
+	// MinSimilarity, between 0 and 1, is the description similarity a match
+	// needs at least.
+	MinSimilarity float64
+}
+
+// ReconcileReport summarises a reconciliation.
+type ReconcileReport struct {
+	Left, Right                         string
+	LeftRows, RightRows                 int
+	Matched                             int
+	LeftUnmatched, RightUnmatched       int
+	LeftUnmatchedSum, RightUnmatchedSum float64
+	scale                               int
+}
+
+func (r ReconcileReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "reconcile: %d matched\n", r.Matched)
+	fmt.Fprintf(&sb, "  %d of %d unmatched in %s, totalling %s\n", r.LeftUnmatched, r.LeftRows, r.Left, FormatNumber(roundTo(r.LeftUnmatchedSum, r.scale), r.scale))
+	fmt.Fprintf(&sb, "  %d of %d unmatched in %s, totalling %s\n", r.RightUnmatched, r.RightRows, r.Right, FormatNumber(roundTo(r.RightUnmatchedSum, r.scale), r.scale))
+	return sb.String()
+}
+
+// reconcileRecord is a row of either file with the values it is matched on.
+type reconcileRecord struct {
+	row     []string
+	day     int64
+	cents   int64
+	key     string // the description reduced by descriptionKey
+	valid   bool   // the date and amount could be read
+	matched bool
+}
+
+// reconcileCandidate is a possible match of left and right records.
+type reconcileCandidate struct {
+	left, right int
+	similarity  float64
+	gap         int64
+}
+
+// ReconcileCSVFiles matches the records of the left and right files and
+// writes the matched pairs and the unmatched records of either side to dir.
+// Duplicates and transfers are looked for across both files and left out.
+func (m *Merger) ReconcileCSVFiles(left, right string, r Reconcile, dir string) (ReconcileReport, error) {
+	report := ReconcileReport{Left: left, Right: right}
+	m.admission = m.admitAcross([]string{left, right})
+	defer func() {
+		m.admission.close()
+		m.admission = nil
+	}()
+	l, lrecs, err := m.reconcileSide(left, r.LeftDate, r.LeftAmount, r.LeftDescription, &report.scale)
+	if err != nil {
+		return report, err
+	}
+	rs, rrecs, err := m.reconcileSide(right, r.RightDate, r.RightAmount, r.RightDescription, &report.scale)
+	if err != nil {
+		return report, err
+	}
+	report.LeftRows, report.RightRows = len(lrecs), len(rrecs)
+	pairs := r.match(lrecs, rrecs)
+	report.Matched = len(pairs)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return report, err
+	}
+	write := func(file string, fn func(w *csv.Writer)) error {
+		name := filepath.Join(dir, file)
+		f := m.outputFile(&name)
+		defer closeFile(f)
+		w := csv.NewWriter(f)
+		fn(w)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		fmt.Printf("%v <- %s, %s\n", m.OutputFileName, left, right)
+		return nil
+	}
+	err = write(ReconcileMatchedFile, func(w *csv.Writer) {
+		writeLine(w, append(joinHeader(l, rs, Join{}), "Similarity", "DaysApart"))
+		for _, p := range pairs {
+			row := joinRow(l, rs, lrecs[p.left].row, rrecs[p.right].row)
+			writeLine(w, append(row, FormatNumber(roundTo(p.similarity, 2), 2), fmt.Sprint(p.gap)))
+		}
+	})
+	if err != nil {
+		return report, err
+	}
+	unmatched := func(side *joinSide, recs []reconcileRecord, count *int, sum *float64) func(w *csv.Writer) {
+		return func(w *csv.Writer) {
+			writeLine(w, side.header)
+			for _, rec := range recs {
+				if !rec.matched {
+					writeLine(w, rec.row)
+					*count++
+					*sum += float64(rec.cents) / 100
+				}
+			}
+		}
+	}
+	if err := write(ReconcileUnmatchedLeftFile, unmatched(l, lrecs, &report.LeftUnmatched, &report.LeftUnmatchedSum)); err != nil {
+		return report, err
+	}
+	err = write(ReconcileUnmatchedRightFile, unmatched(rs, rrecs, &report.RightUnmatched, &report.RightUnmatchedSum))
+	return report, err
+}
+
+// reconcileSide reads the records of one file, widening scale to the decimal
+// places of its amounts.
+func (m *Merger) reconcileSide(file, date, amount, description string, scale *int) (*joinSide, []reconcileRecord, error) {
+	side, err := m.joinSide(file, nil, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := m.scan(file, nil)
+	defer s.close()
+	cols := []string{date, amount}
+	if description != "" {
+		cols = append(cols, description)
+	}
+	if err := s.requireColumns(cols...); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, err)
+	}
+	var recs []reconcileRecord
+	m.eachAdmitted(s, func(record []string) {
+		rec := reconcileRecord{row: s.output(record)}
+		d, ok := ParseDate(s.value(record, date))
+		a, ok2 := ParseNumber(s.value(record, amount))
+		if ok && ok2 {
+			rec.valid = true
+			rec.day = d.Unix() / 86400
+			rec.cents = int64(math.Round(a * 100))
+			if p := DecimalPlaces(s.value(record, amount)); p > *scale {
+				*scale = p
+			}
+		}
+		if description != "" {
+			rec.key = descriptionKey(s.value(record, description))
+		}
+		recs = append(recs, rec)
+	})
+	return side, recs, nil
+}
+
+// match pairs left and right records, best candidates first, and returns the
+// pairs in the order of the left records.
+func (r Reconcile) match(left, right []reconcileRecord) []reconcileCandidate {
+	byCents := make(map[int64][]int)
+	for j, rec := range right {
+		if rec.valid {
+			byCents[rec.cents] = append(byCents[rec.cents], j)
+		}
+	}
+	var candidates []reconcileCandidate
+	for i, l := range left {
+		if !l.valid {
+			continue
+		}
+		for _, j := range byCents[l.cents] {
+			gap := l.day - right[j].day
+			if gap < 0 {
+				gap = -gap
+			}
+			if gap > int64(r.Days) {
+				continue
+			}
+			sim := similarity(l.key, right[j].key)
+			if sim < r.MinSimilarity {
+				continue
+			}
+			candidates = append(candidates, reconcileCandidate{left: i, right: j, similarity: sim, gap: gap})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		ca, cb := candidates[a], candidates[b]
+		if ca.similarity != cb.similarity {
+			return ca.similarity > cb.similarity
+		}
+		return ca.gap < cb.gap
+	})
+	var pairs []reconcileCandidate
+	for _, c := range candidates {
+		if left[c.left].matched || right[c.right].matched {
+			continue
+		}
+		left[c.left].matched, right[c.right].matched = true, true
+		pairs = append(pairs, c)
+	}
+	sort.Slice(pairs, func(a, b int) bool { return pairs[a].left < pairs[b].left })
+	return pairs
+}
+
+// similarity returns the Sørensen–Dice coefficient of the letter pairs of a
+// and b: 1 for equal descriptions, 0 for descriptions without a pair in
+// common.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	pairs := func(s string) map[string]int {
+		counts := make(map[string]int)
+		for _, word := range strings.Fields(s) {
+			runes := []rune(word)
+			for i := 0; i+1 < len(runes); i++ {
+				counts[string(runes[i:i+2])]++
+			}
+		}
+		return counts
+	}
+	pa, pb := pairs(a), pairs(b)
+	total, common := 0, 0
+	for p, n := range pa {
+		total += n
+		if nb, ok := pb[p]; ok {
+			if nb < n {
+				common += nb
+			} else {
+				common += n
+			}
+		}
+	}
+	for _, n := range pb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(common) / float64(total)
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	var tests = []struct {
+		name    string
+		min     float64
+		matched int
+		files   map[string]string
+	}{
+		{"amount and date", 0, 4, map[string]string{
+			ReconcileMatchedFile: `ledger_Date,Memo,ledger_Amount,bank_Date,Description,bank_Amount,Similarity,DaysApart
+2024-03-01,Salary March,2500.00,2024-03-01,ACME PAYROLL,2500.00,0.00,0
+2024-03-04,Office rent,-1200.00,2024-03-05,RENT MARCH,-1200.00,0.40,1
+2024-03-05,Amazon office supplies,-45.99,2024-03-08,AMAZON OFFICE SUPPLIES,-45.99,1.00,3
+2024-03-05,Amazon printer ink,-45.99,2024-03-06,AMZN Mktp printer ink,-45.99,0.67,1
+`,
+			ReconcileUnmatchedLeftFile:  "Date,Memo,Amount\n2024-03-12,Client lunch,-86.40\n",
+			ReconcileUnmatchedRightFile: "Date,Description,Amount\n2024-03-15,BANK FEE,-12.00\n",
+		}},
+		{"similar descriptions", 0.5, 2, map[string]string{
+			ReconcileUnmatchedLeftFile:  "Date,Memo,Amount\n2024-03-01,Salary March,2500.00\n2024-03-04,Office rent,-1200.00\n2024-03-12,Client lunch,-86.40\n",
+			ReconcileUnmatchedRightFile: "Date,Description,Amount\n2024-03-01,ACME PAYROLL,2500.00\n2024-03-05,RENT MARCH,-1200.00\n2024-03-15,BANK FEE,-12.00\n",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r := Reconcile{Days: 3, LeftDate: "Date", RightDate: "Date", LeftAmount: "Amount", RightAmount: "Amount",
+				LeftDescription: "Memo", RightDescription: "Description", MinSimilarity: tt.min}
+			report, err := new(Merger).ReconcileCSVFiles("../cmd/fixtures/ledger.csv", "../cmd/fixtures/bank.csv", r, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Matched != tt.matched || report.LeftUnmatched+report.Matched != 5 || report.RightUnmatched+report.Matched != 5 {
+				t.Errorf("got report %+v, want %d matched", report, tt.matched)
+			}
+			for file, want := range tt.files {
+				b, err := os.ReadFile(filepath.Join(dir, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != want {
+					t.Errorf("%s got:\n%s\nwant:\n%s", file, b, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileDedupe(t *testing.T) {
+	r := Reconcile{Days: 3, LeftDate: "Date", RightDate: "Date", LeftAmount: "Amount", RightAmount: "Amount"}
+	m := &Merger{Dedupe: &Dedupe{Key: []string{"Amount"}}}
+	report, err := m.ReconcileCSVFiles("../cmd/fixtures/ledger.csv", "../cmd/fixtures/bank.csv", r, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every bank amount but the fee duplicates a ledger amount
+	if report.LeftRows != 4 || report.RightRows != 1 || report.Matched != 0 {
+		t.Errorf("got report %+v, want 4 and 1 rows", report)
+	}
+}
+
+func TestReconcileMissingColumn(t *testing.T) {
+	r := Reconcile{LeftDate: "Date", RightDate: "Date", LeftAmount: "Amount", RightAmount: "Amount", LeftDescription: "Description", RightDescription: "Description"}
+	if _, err := new(Merger).ReconcileCSVFiles("../cmd/fixtures/ledger.csv", "../cmd/fixtures/bank.csv", r, t.TempDir()); err == nil {
+		t.Error("ledger.csv has no Description column, want an error")
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		want float64
+	}{
+		{"amazon", "amazon", 1},
+		{"", "", 1},
+		{"night", "nacht", 0.25},
+		{"rent", "", 0},
+		{"abc", "xyz", 0},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
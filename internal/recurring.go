@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const DefaultRecurringFile = "recurring.csv"
+
+// DefaultRecurringMinCount and DefaultRecurringTolerance are the defaults of
+// Recurring.MinCount and Recurring.Tolerance.
+const (
+	DefaultRecurringMinCount  = 3
+	DefaultRecurringTolerance = 0.2
+)
+
+// Recurring configures the detection of payments repeating at a regular
+// cadence, such as subscriptions.
+type Recurring struct {
+	DateColumn        string
+	DescriptionColumn string
+	AmountColumn      string
+	// MinCount is the number of payments a series needs at least; annual
+	// series need only two.
+	MinCount int
+	// Tolerance is how far, as a fraction of the median, a payment's amount
+	// may be from the others of its series.
+	Tolerance float64
+}
+
+// cadence is a kind of regular interval between payments.
+type cadence struct {
+	name     string
+	min, max int // days between payments
+	next     func(time.Time) time.Time
+}
+
+var cadences = []cadence{
+	{"weekly", 6, 8, func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }},
+	{"monthly", 27, 33, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"annual", 355, 375, func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+// payment is one row considered for a recurring series.
+type payment struct {
+	date        time.Time
+	description string
+	amount      float64
+	scale       int
+}
+
+// RecurringCSVFiles finds the recurring payments among the rows of files and
+// writes one row per series to the output file.
+func (m *Merger) RecurringCSVFiles(files []string, r Recurring, outputFilename *string) {
+	if outputFilename == nil {
+		name := DefaultRecurringFile
+		outputFilename = &name
+	}
+	f := m.outputFile(outputFilename)
+	defer closeFile(f)
+
+	cw := csv.NewWriter(f)
+	m.recurring(cw, files, r)
+	fmt.Printf("%v <- %s\n", m.OutputFileName, strings.Join(files, ", "))
+}
+
+func (m *Merger) recurring(w *csv.Writer, files []string, r Recurring) {
+	groups := make(map[string][]payment)
+	var keys []string
+	m.eachRow(files, []string{r.DateColumn, r.DescriptionColumn, r.AmountColumn}, func(_ int, row []string) {
+		date, ok := ParseDate(row[0])
+		amount, ok2 := ParseNumber(row[2])
+		if !ok || !ok2 || amount == 0 {
+			return
+		}
+		k := descriptionKey(row[1])
+		if amount < 0 {
+			k += "\x1f-"
+		}
+		if _, seen := groups[k]; !seen {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], payment{date: date, description: row[1], amount: amount, scale: DecimalPlaces(row[2])})
+	})
+
+	var series [][]string
+	for _, k := range keys {
+		if s := r.series(groups[k]); s != nil {
+			series = append(series, s)
+		}
+	}
+	kind := kindOf(columnValues(series, 0))
+	sort.SliceStable(series, func(i, j int) bool { return kind.compare(series[i][0], series[j][0]) < 0 })
+
+	writeLine(w, []string{r.DescriptionColumn, "Cadence", "Count", "AverageAmount", "FirstSeen", "LastSeen", "NextExpected"})
+	for _, s := range series {
+		writeLine(w, s)
+	}
+	w.Flush()
+}
+
+// series returns the output row of the payments of one description when they
+// recur, nil otherwise.
+func (r Recurring) series(payments []payment) []string {
+	payments = r.similarAmounts(payments)
+	sort.SliceStable(payments, func(i, j int) bool { return payments[i].date.Before(payments[j].date) })
+	if len(payments) < 2 {
+		return nil
+	}
+	gaps := make([]int, len(payments)-1)
+	for i := 1; i < len(payments); i++ {
+		gaps[i-1] = int(math.Round(payments[i].date.Sub(payments[i-1].date).Hours() / 24))
+	}
+	sorted := append([]int{}, gaps...)
+	sort.Ints(sorted)
+	median := sorted[len(sorted)/2]
+
+	for _, c := range cadences {
+		if median < c.min || median > c.max {
+			continue
+		}
+		if len(payments) < r.MinCount && c.name != "annual" {
+			return nil
+		}
+		// most intervals must fit the cadence, allowing for a missed or
+		// doubled payment now and then
+		fit := 0
+		for _, g := range gaps {
+			if g >= c.min && g <= c.max {
+				fit++
+			}
+		}
+		if fit*4 < len(gaps)*3 {
+			return nil
+		}
+		sum, scale := 0.0, 0
+		for _, p := range payments {
+			sum += p.amount
+			if p.scale > scale {
+				scale = p.scale
+			}
+		}
+		first, last := payments[0], payments[len(payments)-1]
+		return []string{
+			last.description,
+			c.name,
+			fmt.Sprint(len(payments)),
+			FormatNumber(roundTo(sum/float64(len(payments)), scale), scale),
+			first.date.Format("2006-01-02"),
+			last.date.Format("2006-01-02"),
+			c.next(last.date).Format("2006-01-02"),
+		}
+	}
+	return nil
+}
+
+// similarAmounts returns the payments whose amount is within Tolerance of the
+// median amount.
+func (r Recurring) similarAmounts(payments []payment) []payment {
+	amounts := make([]float64, len(payments))
+	for i, p := range payments {
+		amounts[i] = math.Abs(p.amount)
+	}
+	sort.Float64s(amounts)
+	median := amounts[len(amounts)/2]
+	var similar []payment
+	for _, p := range payments {
+		if math.Abs(math.Abs(p.amount)-median) <= median*r.Tolerance {
+			similar = append(similar, p)
+		}
+	}
+	return similar
+}
+
+// descriptionKey reduces a description to the words identifying a payee, so
+// that e.g. "NETFLIX.COM 8841" and "Netflix.com 9920" fall in one series.
+func descriptionKey(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestRecurring(t *testing.T) {
+	var tests = []struct {
+		name     string
+		minCount int
+		expected string
+	}{
+		{"default", DefaultRecurringMinCount, `Description,Cadence,Count,AverageAmount,FirstSeen,LastSeen,NextExpected
+Domain renewal,annual,2,-12.00,2024-03-15,2025-03-14,2026-03-14
+Gym membership,weekly,5,-40.40,2024-01-05,2024-04-05,2024-04-12
+Netflix.com 5512,monthly,4,-16.74,2024-01-03,2024-04-03,2024-05-03
+Payroll,monthly,3,2500.00,2024-04-30,2024-06-28,2024-07-28
+`},
+		{"min count", 4, `Description,Cadence,Count,AverageAmount,FirstSeen,LastSeen,NextExpected
+Domain renewal,annual,2,-12.00,2024-03-15,2025-03-14,2026-03-14
+Gym membership,weekly,5,-40.40,2024-01-05,2024-04-05,2024-04-12
+Netflix.com 5512,monthly,4,-16.74,2024-01-03,2024-04-03,2024-05-03
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Recurring{DateColumn: "Date", DescriptionColumn: "Description", AmountColumn: "Amount", MinCount: tt.minCount, Tolerance: DefaultRecurringTolerance}
+			w := bytes.NewBufferString("")
+			new(Merger).recurring(csv.NewWriter(w), []string{"../cmd/fixtures/subscriptions.csv"}, r)
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestDescriptionKey(t *testing.T) {
+	var tests = []struct {
+		in, want string
+	}{
+		{"NETFLIX.COM 8841", "netflix com"},
+		{"Netflix.com  9920", "netflix com"},
+		{"SQ *COFFEE #12", "sq coffee"},
+		{"12345", ""},
+	}
+	for _, tt := range tests {
+		if got := descriptionKey(tt.in); got != tt.want {
+			t.Errorf("descriptionKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultReshapeDir is where pivot and unpivot write their output files.
+const DefaultReshapeDir = "reshaped"
+
+// Pivot turns the values of one column into columns of their own: one output
+// row per distinct combination of the Rows columns, one output column per
+// distinct value of Column, each cell aggregating Value with Func.
+type Pivot struct {
+	Rows   []string
+	Column string
+	Value  string
+	Func   string
+}
+
+// Unpivot (melt) turns each of Columns into a row of its own holding the ID
+// columns, the column's name under NameColumn and its value under
+// ValueColumn. Empty Columns means every column not in ID, and empty ID every
+// column not in Columns.
+type Unpivot struct {
+	ID          []string
+	Columns     []string
+	NameColumn  string
+	ValueColumn string
+}
+
+// ReshapeCSVFiles writes each of files, reshaped by reshape, to a file of the
+// same name in dir, so the results can be merged like any other input. It
+// writes nothing when an output would replace an input, or two inputs share
+// a name. Duplicates and transfers are looked for across all of files.
+func (m *Merger) ReshapeCSVFiles(files []string, dir string, reshape func(w *csv.Writer, file string) error) error {
+	names, err := reshapeOutputs(files, dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	m.admission = m.admitAcross(files)
+	defer func() {
+		m.admission.close()
+		m.admission = nil
+	}()
+	for i, file := range files {
+		f := m.outputFile(&names[i])
+		w := csv.NewWriter(f)
+		err := reshape(w, file)
+		w.Flush()
+		closeFile(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		fmt.Printf("%v <- %s\n", m.OutputFileName, file)
+	}
+	return nil
+}
+
+// reshapeOutputs returns the files in dir that files are reshaped to.
+func reshapeOutputs(files []string, dir string) ([]string, error) {
+	names := make([]string, len(files))
+	from := make(map[string]string) // output name -> input
+	for i, file := range files {
+		names[i] = filepath.Join(dir, filepath.Base(file))
+		if other, ok := from[names[i]]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", other, file, names[i])
+		}
+		from[names[i]] = file
+	}
+	for _, name := range names {
+		for _, file := range files {
+			if sameFile(name, file) {
+				return nil, fmt.Errorf("%s would overwrite input %s, choose another --dir", name, file)
+			}
+		}
+	}
+	return names, nil
+}
+
+// sameFile reports whether the paths a and b name the same file.
+func sameFile(a, b string) bool {
+	if absA, err := filepath.Abs(a); err == nil {
+		if absB, err := filepath.Abs(b); err == nil && absA == absB {
+			return true
+		}
+	}
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	return err == nil && os.SameFile(fa, fb)
+}
+
+// requireColumns returns an error naming the first of cols missing from s,
+// matching names as rename does.
+func (s *fileScan) requireColumns(cols ...string) error {
+	s.rename(cols)
+	for _, c := range cols {
+		if _, ok := s.index[c]; !ok {
+			return fmt.Errorf("column %q not found in %v", c, s.header)
+		}
+	}
+	return nil
+}
+
+// PivotFile writes file pivoted by p to w.
+func (m *Merger) PivotFile(w *csv.Writer, file string, p Pivot) error {
+	s := m.scan(file, nil)
+	defer s.close()
+	if err := s.requireColumns(append([]string{p.Column, p.Value}, p.Rows...)...); err != nil {
+		return err
+	}
+
+	type group struct {
+		key  []string
+		accs map[string]*accumulator
+	}
+	groups := make(map[string]*group)
+	var order []*group
+	seen := make(map[string]bool)
+	var pivoted []string
+	m.eachAdmitted(s, func(record []string) {
+		key := make([]string, len(p.Rows))
+		for i, r := range p.Rows {
+			key[i] = s.value(record, r)
+		}
+		k := strings.Join(key, "\x1f")
+		g, ok := groups[k]
+		if !ok {
+			g = &group{key: key, accs: make(map[string]*accumulator)}
+			groups[k] = g
+			order = append(order, g)
+		}
+		col := s.value(record, p.Column)
+		if !seen[col] {
+			seen[col] = true
+			pivoted = append(pivoted, col)
+		}
+		if g.accs[col] == nil {
+			g.accs[col] = &accumulator{}
+		}
+		g.accs[col].add(p.Func, s.value(record, p.Value))
+	})
+	kind := kindOf(pivoted)
+	sort.SliceStable(pivoted, func(i, j int) bool { return kind.compare(pivoted[i], pivoted[j]) < 0 })
+
+	writeLine(w, append(append([]string{}, p.Rows...), pivoted...))
+	for _, g := range order {
+		row := append([]string{}, g.key...)
+		for _, col := range pivoted {
+			value := ""
+			if acc := g.accs[col]; acc != nil {
+				value = acc.result(p.Func)
+			}
+			row = append(row, value)
+		}
+		writeLine(w, row)
+	}
+	return nil
+}
+
+// UnpivotFile writes file melted by u to w.
+func (m *Merger) UnpivotFile(w *csv.Writer, file string, u Unpivot) error {
+	s := m.scan(file, nil)
+	defer s.close()
+	if err := s.requireColumns(append(append([]string{}, u.ID...), u.Columns...)...); err != nil {
+		return err
+	}
+
+	ids, melted := u.ID, u.Columns
+	in := func(list []string, h string) bool {
+		for _, c := range list {
+			if c == h {
+				return true
+			}
+		}
+		return false
+	}
+	if len(melted) == 0 {
+		for _, h := range s.outputNames() {
+			if !in(ids, h) {
+				melted = append(melted, h)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		for _, h := range s.outputNames() {
+			if !in(melted, h) {
+				ids = append(ids, h)
+			}
+		}
+	}
+
+	writeLine(w, append(append([]string{}, ids...), u.NameColumn, u.ValueColumn))
+	m.eachAdmitted(s, func(record []string) {
+		for _, col := range melted {
+			out := make([]string, 0, len(ids)+2)
+			for _, id := range ids {
+				out = append(out, s.value(record, id))
+			}
+			writeLine(w, append(out, col, s.value(record, col)))
+		}
+	})
+	return nil
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPivotFile(t *testing.T) {
+	month, _ := ParseComputed("Month = substr(Date, 0, 7)")
+	m := &Merger{Computed: []Computed{month}}
+	w := bytes.NewBufferString("")
+	cw := csv.NewWriter(w)
+	err := m.PivotFile(cw, "../cmd/fixtures/statement_feb.csv", Pivot{Rows: []string{"Description"}, Column: "Month", Value: "Amount", Func: "sum"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.Flush()
+
+	expected := `Description,2024-01,2024-02
+Rent,,-1200.00
+Coffee,,-4.50
+Payroll,2000.00,
+`
+	if w.String() != expected {
+		t.Errorf("TestPivotFile got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+
+	err = m.PivotFile(cw, "../cmd/fixtures/statement_feb.csv", Pivot{Column: "Memo", Value: "Amount", Func: "sum"})
+	if err == nil {
+		t.Errorf("expected an error for a missing column")
+	}
+}
+
+func TestUnpivotFile(t *testing.T) {
+	var tests = []struct {
+		name string
+		u    Unpivot
+		want string
+	}{
+		{
+			"id only",
+			Unpivot{ID: []string{"Category"}, NameColumn: "Month", ValueColumn: "Amount"},
+			`Category,Month,Amount
+Grocery,Jan,410.25
+Grocery,Feb,388.10
+Grocery,Mar,402.00
+Dining,Jan,120.00
+Dining,Feb,
+Dining,Mar,95.50
+`,
+		},
+		{
+			"columns only",
+			Unpivot{Columns: []string{"Mar"}, NameColumn: "Name", ValueColumn: "Value"},
+			`Category,Jan,Feb,Name,Value
+Grocery,410.25,388.10,Mar,402.00
+Dining,120.00,,Mar,95.50
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := bytes.NewBufferString("")
+			cw := csv.NewWriter(w)
+			if err := new(Merger).UnpivotFile(cw, "../cmd/fixtures/budget_wide.csv", tt.u); err != nil {
+				t.Fatal(err)
+			}
+			cw.Flush()
+			if w.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestReshapeCSVFiles(t *testing.T) {
+	dir := t.TempDir()
+	m := new(Merger)
+	err := m.ReshapeCSVFiles([]string{"../cmd/fixtures/budget_wide.csv"}, dir, func(w *csv.Writer, file string) error {
+		return m.UnpivotFile(w, file, Unpivot{ID: []string{"Category"}, NameColumn: "Month", ValueColumn: "Amount"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "budget_wide.csv")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReshapeCSVFilesKeepsInputs(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "budget_wide.csv")
+	content, err := os.ReadFile("../cmd/fixtures/budget_wide.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(input, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(t.TempDir(), "budget_wide.csv")
+	if err := os.WriteFile(other, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := new(Merger)
+	unpivot := func(w *csv.Writer, file string) error {
+		return m.UnpivotFile(w, file, Unpivot{ID: []string{"Category"}, NameColumn: "Month", ValueColumn: "Amount"})
+	}
+	var tests = []struct {
+		name  string
+		files []string
+		dir   string
+	}{
+		{"output is the input", []string{input}, dir},
+		{"output is the input, spelled differently", []string{input}, dir + "/."},
+		{"inputs share a name", []string{input, other}, t.TempDir()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.ReshapeCSVFiles(tt.files, tt.dir, unpivot); err == nil {
+				t.Error("ReshapeCSVFiles() should fail")
+			}
+			if got, _ := os.ReadFile(input); !bytes.Equal(got, content) {
+				t.Errorf("input changed to %q", got)
+			}
+		})
+	}
+}
+
+func TestReshapeCSVFilesAdmit(t *testing.T) {
+	in := t.TempDir()
+	inputs := map[string]string{
+		"checking.csv": `Memo,Date,Description,Amount
+a,2024-01-01,Coffee,-4.50
+a,2024-01-01,Coffee,-4.50
+b,2024-01-02,Rent,-1200.00
+c,2024-01-03,To savings,-100.00
+`,
+		"savings.csv": `Date,Description,Amount
+2024-01-03,From checking,100.00
+2024-01-04,Interest,1.25
+`,
+	}
+	var files []string
+	for _, name := range []string{"checking.csv", "savings.csv"} {
+		files = append(files, filepath.Join(in, name))
+		if err := os.WriteFile(files[len(files)-1], []byte(inputs[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &Merger{
+		Dedupe:    &Dedupe{},
+		Transfers: &Transfers{Days: 3, DateColumn: "Date", AmountColumn: "Amount", Drop: true},
+		Select:    &ColumnSelection{Exclude: []ColumnPattern{{Name: "Memo"}}},
+	}
+	out := t.TempDir()
+	err := m.ReshapeCSVFiles(files, out, func(w *csv.Writer, file string) error {
+		return m.PivotFile(w, file, Pivot{Rows: []string{"Description"}, Column: "Date", Value: "Amount", Func: "sum"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"checking.csv": `Description,2024-01-01,2024-01-02
+Coffee,-4.50,
+Rent,,-1200.00
+`,
+		"savings.csv": `Description,2024-01-04
+Interest,1.25
+`,
+	}
+	for name, expected := range want {
+		got, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("%s got:\n%s\nwant:\n%s", name, got, expected)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReviewProgressSuffix is appended to the name of a file under review to
+// name the file its decisions are kept in until the review is finished.
+const ReviewProgressSuffix = ".review"
+
+// DefaultReviewBelow is the rule confidence under which categorized rows are
+// reviewed.
+const DefaultReviewBelow = 0.8
+
+// Decision is the outcome of reviewing a row: the Category assigned, blank
+// when the row was skipped, and the Pattern of a rule to save, if any.
+type Decision struct {
+	Row      int
+	Category string
+	Pattern  string
+}
+
+// ReviewItem is a row awaiting review.
+type ReviewItem struct {
+	Row    int // data row number, from 1
+	Record []string
+	// Suggested is the low-confidence rule that categorized the row, if any.
+	Suggested *Rule
+}
+
+// Review walks the rows of a merged file that have no category, or whose
+// category comes from a rule with a confidence below Below, and records a
+// decision for each. Decisions are kept in a progress file so an
+// interrupted review can be resumed.
+type Review struct {
+	File       string
+	Header     []string
+	Categories *Categorizer
+	Below      float64
+	Items      []ReviewItem
+	Decisions  []Decision
+
+	category int // position of the category column, possibly past the header
+}
+
+// NewReview reads file and finds the rows to review, skipping those decided
+// in an earlier, unfinished review.
+func NewReview(file string, c *Categorizer, below float64) (*Review, error) {
+	r := &Review{File: file, Categories: c, Below: below}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(f)
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	header, ok := readline(reader)
+	if !ok {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	r.Header = header
+	index := headerIndex(header)
+	var found bool
+	if r.category, found = index[c.CategoryColumn]; !found {
+		r.category = len(header)
+		r.Header = append(append([]string{}, header...), c.CategoryColumn)
+		index[c.CategoryColumn] = r.category
+	}
+
+	n := 0
+	for record, ok := readline(reader); ok; record, ok = readline(reader) {
+		n++
+		if r.headerLine(header, record) {
+			// the rows that follow may not be laid out as the first header says
+			return nil, fmt.Errorf("%s: line %d is a header line; review a file merged with a single header (csv -u)", file, n+1)
+		}
+		if len(record) < len(r.Header) {
+			record = append(record, make([]string, len(r.Header)-len(record))...)
+		}
+		get := rowGetter(index, record)
+		category := strings.TrimSpace(record[r.category])
+		if category == "" {
+			r.Items = append(r.Items, ReviewItem{Row: n, Record: record})
+		} else if rule := c.Find(get); rule != nil && rule.Confidence < below && rule.Category == category {
+			r.Items = append(r.Items, ReviewItem{Row: n, Record: record, Suggested: rule})
+		}
+	}
+	return r, r.loadProgress()
+}
+
+// headerLine reports whether record, read after header, is a header line,
+// as csv writes one per input file unless unified: the header again, or a
+// line naming the category column.
+func (r *Review) headerLine(header, record []string) bool {
+	same := len(record) == len(header)
+	for i, cell := range record {
+		if cell == r.Categories.CategoryColumn {
+			return true
+		}
+		same = same && cell == header[i]
+	}
+	return same
+}
+
+// ProgressFile returns the name of the file decisions are kept in.
+func (r *Review) ProgressFile() string {
+	return r.File + ReviewProgressSuffix
+}
+
+func (r *Review) loadProgress() error {
+	f, err := os.Open(r.ProgressFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer closeFile(f)
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	for _, rec := range records[1:] {
+		n, err := strconv.Atoi(rec[0])
+		if err != nil {
+			return fmt.Errorf("%s: bad row number %q", r.ProgressFile(), rec[0])
+		}
+		r.Decisions = append(r.Decisions, Decision{Row: n, Category: rec[1], Pattern: rec[2]})
+	}
+	return nil
+}
+
+// SaveProgress writes the decisions made so far to the progress file.
+func (r *Review) SaveProgress() error {
+	f, err := os.Create(r.ProgressFile())
+	if err != nil {
+		return err
+	}
+	defer closeFile(f)
+	w := csv.NewWriter(f)
+	writeLine(w, []string{"Row", "Category", "Pattern"})
+	for _, d := range r.Decisions {
+		writeLine(w, []string{strconv.Itoa(d.Row), d.Category, d.Pattern})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Pending returns the items without a decision, in file order.
+func (r *Review) Pending() []ReviewItem {
+	decided := make(map[int]bool)
+	for _, d := range r.Decisions {
+		decided[d.Row] = true
+	}
+	var pending []ReviewItem
+	for _, it := range r.Items {
+		if !decided[it.Row] {
+			pending = append(pending, it)
+		}
+	}
+	return pending
+}
+
+// Decide records a decision, replacing any earlier one for the same row.
+func (r *Review) Decide(d Decision) {
+	for i := range r.Decisions {
+		if r.Decisions[i].Row == d.Row {
+			r.Decisions = append(r.Decisions[:i], r.Decisions[i+1:]...)
+			break
+		}
+	}
+	r.Decisions = append(r.Decisions, d)
+}
+
+// Undo forgets the last decision and returns it.
+func (r *Review) Undo() (Decision, bool) {
+	if len(r.Decisions) == 0 {
+		return Decision{}, false
+	}
+	d := r.Decisions[len(r.Decisions)-1]
+	r.Decisions = r.Decisions[:len(r.Decisions)-1]
+	return d, true
+}
+
+// Category returns the category of a review item's row.
+func (r *Review) Category(it ReviewItem) string {
+	return it.Record[r.category]
+}
+
+// Rule returns the rule saved for a decision with a Pattern: the pattern
+// contained in the first text column of the file.
+func (r *Review) Rule(d Decision) *Rule {
+	column := r.Categories.TextColumns[0]
+	index := headerIndex(r.Header)
+	for _, c := range r.Categories.TextColumns {
+		if _, ok := index[c]; ok {
+			column = c
+			break
+		}
+	}
+	return &Rule{Columns: []string{column}, Match: "contains", Pattern: d.Pattern, Category: d.Category, Confidence: 1}
+}
+
+// Apply writes the categories decided so far into the file.
+func (r *Review) Apply() error {
+	categories := make(map[int]string)
+	for _, d := range r.Decisions {
+		if d.Category != "" {
+			categories[d.Row] = d.Category
+		}
+	}
+	src, err := os.Open(r.File)
+	if err != nil {
+		return err
+	}
+	defer closeFile(src)
+	tmp, err := os.CreateTemp(filepath.Dir(r.File), filepath.Base(r.File)+".*")
+	if err != nil {
+		return err
+	}
+	fi, err := src.Stat()
+	if err == nil {
+		err = tmp.Chmod(fi.Mode())
+	}
+	if err != nil {
+		closeFile(tmp)
+		os.Remove(tmp.Name())
+		return err
+	}
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	w := csv.NewWriter(tmp)
+	readline(reader)
+	writeLine(w, r.Header)
+	n := 0
+	for record, ok := readline(reader); ok; record, ok = readline(reader) {
+		n++
+		if len(record) < len(r.Header) {
+			record = append(record, make([]string, len(r.Header)-len(record))...)
+		}
+		if c, ok := categories[n]; ok {
+			record[r.category] = c
+		}
+		writeLine(w, record)
+	}
+	w.Flush()
+	closeFile(tmp)
+	if err := w.Error(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.File)
+}
+
+// Finish applies the decisions, adds the rules they ask for to the rule
+// file and removes the progress file.
+func (r *Review) Finish() error {
+	if err := r.Apply(); err != nil {
+		return err
+	}
+	var rules []*Rule
+	for _, d := range r.Decisions {
+		if d.Pattern != "" && d.Category != "" {
+			rules = append(rules, r.Rule(d))
+		}
+	}
+	if err := r.Categories.SaveRules(rules); err != nil {
+		return err
+	}
+	err := os.Remove(r.ProgressFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
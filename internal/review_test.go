@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reviewFixture copies a merged file and a rule file into a temp dir.
+func reviewFixture(t *testing.T) (merged, rules string) {
+	dir := t.TempDir()
+	merged = filepath.Join(dir, "merged.csv")
+	rules = filepath.Join(dir, "rules.csv")
+	files := map[string]string{
+		merged: "Date,Description,Amount,Category\n2024-01-30,Coffee,-4.50,Dining\n2024-01-31,Payroll,2000.00,\n2024-02-01,Rent,-1200.00,Housing\n",
+		rules:  "Pattern,Category,Confidence\ncoffee,Dining,0.5\nrent,Housing,",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return merged, rules
+}
+
+func TestReview(t *testing.T) {
+	merged, rules := reviewFixture(t)
+	c, err := LoadRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReview(merged, c, DefaultReviewBelow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := r.Pending()
+	if len(pending) != 2 || pending[0].Row != 1 || pending[0].Suggested == nil || pending[1].Row != 2 || pending[1].Suggested != nil {
+		t.Fatalf("Pending() = %+v, want rows 1 (suggested) and 2", pending)
+	}
+
+	r.Decide(Decision{Row: 1, Category: "Coffee"})
+	if d, ok := r.Undo(); !ok || d.Row != 1 {
+		t.Errorf("Undo() = %+v, %v", d, ok)
+	}
+	r.Decide(Decision{Row: 1, Category: "Dining"})
+	if err := r.SaveProgress(); err != nil {
+		t.Fatal(err)
+	}
+
+	// resume from the progress file
+	r, err = NewReview(merged, c, DefaultReviewBelow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := r.Pending(); len(pending) != 1 || pending[0].Row != 2 {
+		t.Fatalf("resumed Pending() = %+v, want row 2", pending)
+	}
+	r.Decide(Decision{Row: 2, Category: "Income", Pattern: "payroll"})
+	if err := r.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ file, want string }{
+		{merged, "Date,Description,Amount,Category\n2024-01-30,Coffee,-4.50,Dining\n2024-01-31,Payroll,2000.00,Income\n2024-02-01,Rent,-1200.00,Housing\n"},
+		{rules, "Pattern,Category,Confidence\ncoffee,Dining,0.5\nrent,Housing,\npayroll,Income,\n"},
+	} {
+		b, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s got:\n%s\nwant:\n%s", filepath.Base(tt.file), b, tt.want)
+		}
+	}
+	if _, err := os.Stat(r.ProgressFile()); !os.IsNotExist(err) {
+		t.Errorf("progress file should be removed, got %v", err)
+	}
+}
+
+func TestReviewAddsCategoryColumn(t *testing.T) {
+	r, err := NewReview("../cmd/fixtures/statement_jan.csv", NewCategorizer(), DefaultReviewBelow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Items) != 3 || r.Header[len(r.Header)-1] != "Category" || r.Category(r.Items[0]) != "" {
+		t.Errorf("got header %v and %d items, want a Category column and 3 items", r.Header, len(r.Items))
+	}
+}
+
+func TestReviewRepeatedHeader(t *testing.T) {
+	merged, rules := reviewFixture(t)
+	c, err := LoadRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{
+		"Date,Description,Amount,Category\n",
+		"Trans Date,Merchant,Amt,Category\n",
+		"Date,Description,Amount\n",
+	} {
+		content := "Date,Description,Amount\n2024-01-31,Payroll,2000.00\n" + section + "2024-02-01,Rent,-1200.00\n"
+		if err := os.WriteFile(merged, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewReview(merged, c, DefaultReviewBelow); err == nil {
+			t.Errorf("NewReview() of a file with a second header %q should fail", section)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"os"
+)
+
+// fileScan streams the rows of one input file through the row pipeline used
+// by combine: computed columns are evaluated, the Where filter applied and
+// the requested columns selected, one row at a time.
+type fileScan struct {
+	file     string
+	header   []string       // the file's header with computed columns appended
+	spelled  []string       // header as spelled in the file, see rename
+	index    map[string]int // position of each name in header
+	indexes  []int          // the columns written to the output, in order
+	negate   map[string]bool
+	lookups  []int       // the column each of Lookups matches, -1 if none
+	category categorized // how the row last returned by next was categorized
+
+	m      *Merger
+	src    *os.File
+	reader *layoutReader
+}
+
+// scan opens file and reads its header, found as described by Layout. A file
+// without any rows has a nil header and no data rows.
+func (m *Merger) scan(file string, columns []string) *fileScan {
+	s := &fileScan{file: file, m: m, src: openFile(file), negate: make(map[string]bool)}
+	s.reader = m.openLayout(file, s.src)
+	if s.reader.header == nil {
+		return s
+	}
+	s.header = extendHeader(s.reader.header, m.DerivedColumns())
+	s.spelled = s.header
+	s.rename(append(append(append([]string{}, columns...), m.unified...), m.NegateColumns...))
+	s.indexes = ColumnIndexes(s.header, columns)
+	if columns == nil {
+		s.indexes = allIndexes(s.header)
+	}
+	if m.Select != nil {
+		s.indexes = m.Select.indexes(s.header, s.indexes)
+	}
+	if m.unified != nil {
+		s.align(m.unified)
+	}
+	for _, col := range m.NegateColumns {
+		s.negate[col] = true
+	}
+	s.lookups = make([]int, len(m.Lookups))
+	for i, l := range m.Lookups {
+		s.lookups[i] = -1
+		if found := ColumnIndexes(s.header, []string{l.Key}); len(found) > 0 {
+			s.lookups[i] = found[0]
+		}
+	}
+	return s
+}
+
+// DerivedColumns returns the names of the columns added to every row by the
+// row pipeline: computed columns, then lookup columns, the original amount
+// and currency, the category columns and the TransferID column (unless
+// transfers are dropped).
+func (m *Merger) DerivedColumns() []string {
+	var names []string
+	for _, c := range m.Computed {
+		names = append(names, c.Name)
+	}
+	for _, l := range m.Lookups {
+		names = append(names, l.Columns...)
+	}
+	if m.Currency != nil {
+		names = append(names, m.Currency.Columns()...)
+	}
+	if m.Categories != nil {
+		names = append(names, m.Categories.Columns()...)
+	}
+	if m.Transfers != nil && !m.Transfers.Drop {
+		names = append(names, TransferColumn)
+	}
+	return names
+}
+
+// extendHeader appends the names not already part of header.
+func extendHeader(header []string, names []string) []string {
+	if len(names) == 0 {
+		return header
+	}
+	extended := append([]string{}, header...)
+	index := headerIndex(header)
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			index[name] = len(extended)
+			extended = append(extended, name)
+		}
+	}
+	return extended
+}
+
+// rename spells the columns of the header matching one of names, as read by
+// NormalizeHeader, or one of their Aliases, the way names does, so that a
+// config's "Amount" selects a file's "amount " and rows of files spelling it
+// differently line up. Exact matches are left alone.
+func (s *fileScan) rename(names []string) {
+	exact := make(map[string]bool, len(s.header)+len(names))
+	for _, h := range s.header {
+		exact[h] = true
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		wanted[n] = true
+	}
+	renamed := make(map[int]bool)
+	for _, n := range names {
+		if exact[n] {
+			continue
+		}
+		keys := make(map[string]bool)
+		for _, a := range append([]string{n}, s.m.Aliases[n]...) {
+			keys[NormalizeHeader(a)] = true
+		}
+		for i, h := range s.header {
+			if renamed[i] || wanted[h] || !keys[NormalizeHeader(h)] {
+				continue
+			}
+			if len(renamed) == 0 {
+				s.header = append([]string{}, s.header...)
+			}
+			s.header[i] = n
+			renamed[i], exact[n] = true, true
+			break
+		}
+	}
+	s.index = headerIndex(s.header)
+}
+
+// align selects the columns of header, in its order, for the output; columns
+// this file lacks are left blank.
+func (s *fileScan) align(header []string) {
+	s.indexes = make([]int, len(header))
+	for i, h := range header {
+		s.indexes[i] = -1
+		if j, ok := s.index[h]; ok {
+			s.indexes[i] = j
+		}
+	}
+}
+
+// next returns the next data row that passes the Where filter, with its
+// computed, lookup, currency and category columns filled in.
+func (s *fileScan) next() ([]string, bool) {
+	if s.header == nil {
+		return nil, false
+	}
+	for {
+		line, ok := s.reader.next()
+		if !ok {
+			return nil, false
+		}
+		record := line
+		if len(line) < len(s.header) {
+			record = make([]string, len(s.header))
+			copy(record, line)
+		}
+		applyComputed(s.index, record, s.m.Computed)
+		applyLookups(s.index, record, s.m.Lookups, s.lookups)
+		if s.m.Currency != nil {
+			s.m.Currency.apply(s.file, s.index, record)
+		}
+		if s.m.Categories != nil {
+			s.category = s.m.Categories.apply(s.index, record)
+		}
+		if s.m.Where == nil || s.m.Where.Match(rowGetter(s.index, record)) {
+			return record, true
+		}
+	}
+}
+
+// outputHeader returns the header row written for this file, spelled as in
+// the file when OriginalHeaders is set.
+func (s *fileScan) outputHeader() []string {
+	if s.m.OriginalHeaders {
+		return s.names(s.spelled)
+	}
+	return s.outputNames()
+}
+
+// outputNames returns the names of the columns written for this file.
+func (s *fileScan) outputNames() []string {
+	return s.names(s.header)
+}
+
+func (s *fileScan) names(header []string) []string {
+	var cols []string
+	for _, col := range s.indexes {
+		if col >= 0 {
+			cols = append(cols, header[col])
+		}
+	}
+	return cols
+}
+
+// output returns the selected columns of record, negating the values of the
+// columns listed in NegateColumns.
+func (s *fileScan) output(record []string) []string {
+	var cols []string
+	for _, col := range s.indexes {
+		if col < 0 {
+			cols = append(cols, "")
+			continue
+		}
+		value := record[col]
+		if s.negate[s.header[col]] {
+			value = NegateValue(value)
+		}
+		cols = append(cols, value) //the columns we are using in the output file
+	}
+	return cols
+}
+
+func (s *fileScan) close() {
+	closeFile(s.src)
+}
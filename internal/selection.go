@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ColumnSelection picks the columns of each file by name, regular
+// expression or position, for selecting columns without a config file.
+type ColumnSelection struct {
+	// Include lists the columns kept, in output order; empty keeps all.
+	Include []ColumnPattern
+	// Exclude lists the columns dropped from those.
+	Exclude []ColumnPattern
+}
+
+// ColumnPattern matches columns of a file. It is written as a name,
+// matched as by ColumnIndexes, as /REGEX/, or as a position or range of
+// positions in the file counting from 1, such as 3 or 2-5.
+type ColumnPattern struct {
+	Name     string
+	Regexp   *regexp.Regexp
+	From, To int // positions, 0 when not a range
+}
+
+// ParseColumnPattern reads a column pattern.
+func ParseColumnPattern(s string) (ColumnPattern, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return ColumnPattern{}, fmt.Errorf("empty column")
+	case len(s) > 1 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/"):
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return ColumnPattern{}, fmt.Errorf("column %s: %w", s, err)
+		}
+		return ColumnPattern{Regexp: re}, nil
+	}
+	from, to, isRange := strings.Cut(s, "-")
+	a, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return ColumnPattern{Name: s}, nil
+	}
+	b := a
+	if isRange {
+		if b, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+			return ColumnPattern{Name: s}, nil
+		}
+	}
+	if a < 1 || b < a {
+		return ColumnPattern{}, fmt.Errorf("column range %s: want positions from 1, in order", s)
+	}
+	return ColumnPattern{From: a, To: b}, nil
+}
+
+// ParseColumnSelection reads the patterns of the included and excluded
+// columns.
+func ParseColumnSelection(include, exclude []string) (*ColumnSelection, error) {
+	sel := &ColumnSelection{}
+	for _, list := range []struct {
+		specs []string
+		dst   *[]ColumnPattern
+	}{{include, &sel.Include}, {exclude, &sel.Exclude}} {
+		for _, s := range list.specs {
+			p, err := ParseColumnPattern(s)
+			if err != nil {
+				return nil, err
+			}
+			*list.dst = append(*list.dst, p)
+		}
+	}
+	return sel, nil
+}
+
+// matches reports whether the column at position i of a file, named h,
+// matches p.
+func (p ColumnPattern) matches(i int, h string) bool {
+	switch {
+	case p.Regexp != nil:
+		return p.Regexp.MatchString(h)
+	case p.From > 0:
+		return i+1 >= p.From && i+1 <= p.To
+	}
+	return h == p.Name || NormalizeHeader(h) == NormalizeHeader(p.Name)
+}
+
+// indexes returns the positions in header of the columns selected among
+// indexes, or among all of header when indexes is nil.
+func (sel *ColumnSelection) indexes(header []string, indexes []int) []int {
+	if indexes == nil {
+		indexes = allIndexes(header)
+	}
+	if len(sel.Include) > 0 {
+		candidates := indexes
+		added := make(map[int]bool)
+		indexes = nil
+		for _, p := range sel.Include {
+			for _, i := range candidates {
+				if !added[i] && p.matches(i, header[i]) {
+					indexes = append(indexes, i)
+					added[i] = true
+				}
+			}
+		}
+	}
+	var kept []int
+	for _, i := range indexes {
+		excluded := false
+		for _, p := range sel.Exclude {
+			if p.matches(i, header[i]) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestParseColumnPattern(t *testing.T) {
+	var tests = []struct {
+		input    string
+		name     string
+		regexp   string
+		from, to int
+		err      bool
+	}{
+		{input: "ssn", name: "ssn"},
+		{input: " Post Date ", name: "Post Date"},
+		{input: "/^Internal/", regexp: "^Internal"},
+		{input: "3", from: 3, to: 3},
+		{input: "2-5", from: 2, to: 5},
+		{input: "2-x", name: "2-x"},
+		{input: "0", err: true},
+		{input: "5-2", err: true},
+		{input: "/(/", err: true},
+		{input: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p, err := ParseColumnPattern(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParseColumnPattern(%q) error = %v", tt.input, err)
+			}
+			re := ""
+			if p.Regexp != nil {
+				re = p.Regexp.String()
+			}
+			if err == nil && (p.Name != tt.name || re != tt.regexp || p.From != tt.from || p.To != tt.to) {
+				t.Errorf("ParseColumnPattern(%q) = %+v", tt.input, p)
+			}
+		})
+	}
+}
+
+func TestCombineSelection(t *testing.T) {
+	files := []string{"../cmd/fixtures/test.csv", "../cmd/fixtures/transactions.CSV"}
+	var tests = []struct {
+		name             string
+		include, exclude []string
+		unified          bool
+		columns          []string
+		expected         string
+	}{
+		{"exclude", nil, []string{"SSN", "/^Post/"}, false, nil,
+			"first_name,last_name\nJohn,Barry\nKathy,Smith\nBob,McCornick\nTransaction Date,Category,Amount\n20221231,Merchandise,12.36\n20230115,Grocery,68.77\n20230131,Dining,39.98\n"},
+		{"include ranges", []string{"3-4", "1"}, nil, false, nil,
+			"ssn,first_name\n123456,John\n687987,Kathy\n3979870,Bob\nCategory,Amount,Transaction Date\nMerchandise,12.36,20221231\nGrocery,68.77,20230115\nDining,39.98,20230131\n"},
+		{"unified", []string{"/name$/", "Amount"}, []string{"last_name"}, true, nil,
+			"first_name,Amount\nJohn,\nKathy,\nBob,\n,12.36\n,68.77\n,39.98\n"},
+		{"config", nil, []string{"ssn"}, false, []string{"first_name", "ssn", "Amount"},
+			"first_name\nJohn\nKathy\nBob\nAmount\n12.36\n68.77\n39.98\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := ParseColumnSelection(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := &Merger{Select: sel, Unified: tt.unified}
+			w := bytes.NewBufferString("")
+			m.combine(csv.NewWriter(w), files, tt.columns)
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package internal
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultSortChunkRows is the number of rows sorted in memory before they are
+// written to a temp file and merged with the others at the end.
+const DefaultSortChunkRows = 100000
+
+// SortKey orders merged rows by one column.
+type SortKey struct {
+	Column     string
+	Descending bool
+}
+
+// ParseSortKeys reads keys such as "Date" and "-Amount"; a leading minus sorts
+// that column in descending order.
+func ParseSortKeys(spec []string) []SortKey {
+	var keys []SortKey
+	for _, s := range spec {
+		s = strings.TrimSpace(s)
+		k := SortKey{Column: strings.TrimPrefix(s, "-"), Descending: strings.HasPrefix(s, "-")}
+		if k.Column != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// CompareCells orders two cell values: as numbers when both are numbers, as
+// dates when both are dates and otherwise in natural order, where runs of
+// digits compare by value ("Item 9" before "Item 10"). Blank cells sort
+// first.
+//
+// Sorting more than two values this way isn't consistent when a column mixes
+// kinds; sort by the kind of the whole column instead, see kindOf.
+func CompareCells(a, b string) int {
+	return kindOf([]string{a, b}).compare(a, b)
+}
+
+// kindOf picks the kind of a column from a sample of its values: numbers
+// when every non-blank value is a number, dates when every one is a date and
+// text otherwise.
+func kindOf(values []string) valueKind {
+	numbers, dates := true, true
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		if numbers {
+			_, numbers = ParseNumber(v)
+		}
+		if dates {
+			_, dates = ParseDate(v)
+		}
+		if !numbers && !dates {
+			return kindText
+		}
+	}
+	if numbers {
+		return kindNumber
+	}
+	return kindDate
+}
+
+// compare orders two values of a column of kind k. Blank cells sort first,
+// then the values of that kind and then any others in natural order, so
+// values the sample didn't foresee still sort consistently.
+func (k valueKind) compare(a, b string) int {
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	case b == "":
+		return 1
+	}
+	switch k {
+	case kindNumber:
+		x, okx := ParseNumber(a)
+		y, oky := ParseNumber(b)
+		if okx && oky {
+			return compareOrdered(x, y)
+		}
+		if okx != oky {
+			return compareBool(oky, okx)
+		}
+	case kindDate:
+		x, okx := ParseDate(a)
+		y, oky := ParseDate(b)
+		if okx && oky {
+			return x.Compare(y)
+		}
+		if okx != oky {
+			return compareBool(oky, okx)
+		}
+	}
+	return compareNatural(a, b)
+}
+
+// compareBool orders false before true.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+func compareNatural(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			si, sj := i, j
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+			x := strings.TrimLeft(string(ra[si:i]), "0")
+			y := strings.TrimLeft(string(rb[sj:j]), "0")
+			if c := compareOrdered(len(x), len(y)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+			continue
+		}
+		x, y := unicode.ToLower(ra[i]), unicode.ToLower(rb[j])
+		if x != y {
+			return compareOrdered(int(x), int(y))
+		}
+		i++
+		j++
+	}
+	if c := compareOrdered(len(ra)-i, len(rb)-j); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// SortColumns resolves the Sort keys against header, returning an error
+// naming any key column that isn't part of it. Keys name a column as in
+// header or as renamed by Rename, matched exactly or, failing that, as read
+// by NormalizeHeader.
+func (m *Merger) SortColumns(header []string) ([]int, error) {
+	names := make([]string, 0, 2*len(header))
+	positions := make([]int, 0, 2*len(header))
+	for i, h := range header {
+		names, positions = append(names, h), append(positions, i)
+		if to, ok := m.Rename[h]; ok {
+			names, positions = append(names, to), append(positions, i)
+		}
+	}
+	cols := make([]int, len(m.Sort))
+	for i, k := range m.Sort {
+		found := ColumnIndexes(names, []string{k.Column})
+		if len(found) == 0 {
+			return nil, fmt.Errorf("sort column %q is not in the output: %v", k.Column, header)
+		}
+		cols[i] = positions[found[0]]
+	}
+	return cols, nil
+}
+
+// externalSorter sorts rows of any number by sorting chunks of
+// DefaultSortChunkRows in memory, writing each to a temp file and merging the
+// files once all rows have been added. Rows comparing equal keep their input
+// order.
+type externalSorter struct {
+	keys  []SortKey
+	cols  []int
+	kinds []valueKind // picked from the first chunk
+	limit int
+	chunk [][]string
+	dir   string
+	runs  []string
+}
+
+func (m *Merger) newSorter() *externalSorter {
+	cols, err := m.SortColumns(m.unified)
+	if err != nil {
+		LogPanic("Unable to sort.", err)
+	}
+	limit := m.SortChunkRows
+	if limit <= 0 {
+		limit = DefaultSortChunkRows
+	}
+	return &externalSorter{keys: m.Sort, cols: cols, limit: limit}
+}
+
+func (s *externalSorter) less(a, b []string) bool {
+	for i, k := range s.keys {
+		c := s.kinds[i].compare(a[s.cols[i]], b[s.cols[i]])
+		if k.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+func (s *externalSorter) add(row []string) {
+	s.chunk = append(s.chunk, row)
+	if len(s.chunk) >= s.limit {
+		s.spill()
+	}
+}
+
+func (s *externalSorter) sortChunk() {
+	if s.kinds == nil {
+		s.kinds = make([]valueKind, len(s.cols))
+		for i, col := range s.cols {
+			s.kinds[i] = kindOf(columnValues(s.chunk, col))
+		}
+	}
+	sort.SliceStable(s.chunk, func(i, j int) bool { return s.less(s.chunk[i], s.chunk[j]) })
+}
+
+// columnValues returns the values of column col of rows.
+func columnValues(rows [][]string, col int) []string {
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = row[col]
+	}
+	return values
+}
+
+func (s *externalSorter) spill() {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "merger-sort-")
+		if err != nil {
+			LogPanic("Unable to create temp directory.", err)
+		}
+		s.dir = dir
+	}
+	s.sortChunk()
+	name := filepath.Join(s.dir, strconv.Itoa(len(s.runs))+".csv")
+	f := DeleteAndCreateFile(name)
+	w := csv.NewWriter(f)
+	for _, row := range s.chunk {
+		writeLine(w, row)
+	}
+	w.Flush()
+	closeFile(f)
+	s.runs = append(s.runs, name)
+	s.chunk = s.chunk[:0]
+}
+
+// each calls fn with every row in sorted order.
+func (s *externalSorter) each(fn func(row []string)) {
+	if s.runs == nil {
+		s.sortChunk()
+		for _, row := range s.chunk {
+			fn(row)
+		}
+		return
+	}
+	if len(s.chunk) > 0 {
+		s.spill()
+	}
+	h := &runHeap{less: s.less}
+	for i, name := range s.runs {
+		f := openFile(name)
+		defer closeFile(f)
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		if row, ok := readline(r); ok {
+			h.items = append(h.items, runHead{row: row, run: i, reader: r})
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 {
+		top := &h.items[0]
+		fn(top.row)
+		if row, ok := readline(top.reader); ok {
+			top.row = row
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+}
+
+func (s *externalSorter) close() {
+	if s.dir != "" {
+		_ = os.RemoveAll(s.dir)
+	}
+}
+
+// runHead is the next row of one sorted temp file.
+type runHead struct {
+	row    []string
+	run    int
+	reader *csv.Reader
+}
+
+// runHeap yields the smallest head across the runs, preferring earlier runs
+// for equal rows to keep the sort stable.
+type runHeap struct {
+	items []runHead
+	less  func(a, b []string) bool
+}
+
+func (h *runHeap) Len() int { return len(h.items) }
+func (h *runHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less(a.row, b.row) {
+		return true
+	}
+	if h.less(b.row, a.row) {
+		return false
+	}
+	return a.run < b.run
+}
+func (h *runHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *runHeap) Push(x any)    { h.items = append(h.items, x.(runHead)) }
+func (h *runHeap) Pop() any {
+	old := h.items
+	x := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCompareCells(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		want int
+	}{
+		{"9.5", "10.25", -1},
+		{"$1,000.00", "999", 1},
+		{"-4.50", "-4.5", 0},
+		{"01/15/2024", "2024-01-02", 1},
+		{"Jan 2, 2024", "12/31/2023", 1},
+		{"Item 9", "Item 10", -1},
+		{"apple", "Banana", -1},
+		{"", "0", -1},
+		{"Grocery", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"|"+tt.b, func(t *testing.T) {
+			if got := CompareCells(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareCells(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortMixedColumn(t *testing.T) {
+	values := []string{"10", "Item 2", "", "9", "2024-01-05", "1.5", "Item 10"}
+	kind := kindOf(values)
+	if kind != kindText {
+		t.Fatalf("got kind %v, want text", kind)
+	}
+	if kind := kindOf([]string{"10", "", "$9.50"}); kind != kindNumber {
+		t.Errorf("got kind %v, want number", kind)
+	}
+	// a number column with a stray value sorts it after the numbers
+	values = []string{"10", "n/a", "9", "", "1.5"}
+	kind = kindNumber
+	sort.SliceStable(values, func(i, j int) bool { return kind.compare(values[i], values[j]) < 0 })
+	if want := []string{"", "1.5", "9", "10", "n/a"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+}
+
+func TestSortColumns(t *testing.T) {
+	m := &Merger{Rename: map[string]string{"Date": "txn_date"}}
+	header := []string{"Date", "Description", "Amount"}
+	for _, key := range []string{"txn_date", "Txn Date", "description", "Amount"} {
+		m.Sort = ParseSortKeys([]string{key})
+		if _, err := m.SortColumns(header); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	m.Sort = ParseSortKeys([]string{"Balance"})
+	if _, err := m.SortColumns(header); err == nil {
+		t.Error("sorting on a missing column should fail")
+	}
+}
+
+func TestCombineSort(t *testing.T) {
+	files := []string{"../cmd/fixtures/statement_jan.csv", "../cmd/fixtures/statement_feb.csv", "../cmd/fixtures/negative_test.csv"}
+	want := `Date,Description,Amount
+2024-02-02,Coffee,-4.50
+2024-02-01,Rent,-1200.00
+2024-02-01,Rent,-1200.00
+2024-01-31,Payroll,2000.00
+2024-01-31,Payroll,2000.00
+2024-01-30,Coffee,-4.50
+2024-01-03,Purchase 2,-100.25
+2024-01-02,Refund,25.50
+2024-01-01,Purchase 1,-50.00
+`
+	for _, chunk := range []int{0, 2} {
+		m := &Merger{Sort: ParseSortKeys([]string{"-Date", "Amount"}), SortChunkRows: chunk}
+		w := bytes.NewBufferString("")
+		m.combine(csv.NewWriter(w), files, []string{"Date", "Description", "Amount"})
+		if w.String() != want {
+			t.Errorf("chunk %d got:\n%s\nwant:\n%s", chunk, w.String(), want)
+		}
+	}
+}
+
+func TestCombineUnified(t *testing.T) {
+	m := &Merger{Unified: true, NegateColumns: []string{"Amount"}}
+	files := []string{"../cmd/fixtures/negative_test.csv", "../cmd/fixtures/negative_test2.csv"}
+	w := bytes.NewBufferString("")
+	m.combine(csv.NewWriter(w), files, []string{"Date", "Debit", "Description", "Category", "Amount"})
+
+	expected := `Date,Debit,Description,Category,Amount
+2024-01-01,,Purchase 1,,50.00
+2024-01-02,,Refund,,-25.50
+2024-01-03,,Purchase 2,,100.25
+2024-02-01,200.00,,Merch,
+2024-02-02,75.25,,Shopping,
+`
+	if w.String() != expected {
+		t.Errorf("TestCombineUnified got:\n%s\nwant:\n%s", w.String(), expected)
+	}
+}
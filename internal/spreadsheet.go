@@ -1,22 +1,33 @@
 package internal
 
-import "encoding/csv"
-
+// Headers returns the header row of each file, taken as the first line.
 func Headers(files []string) [][]string {
+	return (&Merger{Layout: Layout{HeaderRow: 1}}).Headers(files)
+}
+
+// Headers returns the header row of each file, found as described by
+// m.Layout.
+func (m *Merger) Headers(files []string) [][]string {
 	var r = make([][]string, len(files))
 	for i, f := range files {
-		line, _ := readline(csv.NewReader(openFile(f)))
-		r[i] = line
+		src := openFile(f)
+		r[i] = m.Layout.open(f, src).header
+		closeFile(src)
 	}
 	return r
 }
 
-// ColumnIndexes returns the matching column index of a column position
+// ColumnIndexes returns the matching column index of a column position.
+// Names are matched exactly or, failing that, as read by NormalizeHeader.
 func ColumnIndexes(headers []string, want []string) []int {
 	indexMap := make(map[string]int)
+	keyMap := make(map[string]int)
 	wantMap := make(map[string]bool)
 	for i, header := range headers {
 		indexMap[header] = i
+		if _, ok := keyMap[NormalizeHeader(header)]; !ok {
+			keyMap[NormalizeHeader(header)] = i
+		}
 	}
 	var indexes []int
 	added := make(map[int]bool)
@@ -25,10 +36,24 @@ func ColumnIndexes(headers []string, want []string) []int {
 			continue
 		}
 		wantMap[w] = true
-		if index, ok := indexMap[w]; ok && !added[index] {
+		index, ok := indexMap[w]
+		if !ok {
+			index, ok = keyMap[NormalizeHeader(w)]
+		}
+		if ok && !added[index] {
 			indexes = append(indexes, index)
 			added[index] = true
 		}
 	}
 	return indexes
 }
+
+// allIndexes returns the index of every column in headers, used when no
+// columns were requested.
+func allIndexes(headers []string) []int {
+	indexes := make([]int, len(headers))
+	for i := range headers {
+		indexes[i] = i
+	}
+	return indexes
+}
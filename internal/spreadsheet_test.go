@@ -36,3 +36,12 @@ func TestShowHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestColumnIndexes(t *testing.T) {
+	headers := []string{"Date", "amount ", "Amount_2", "DESCRIPTION"}
+	got := ColumnIndexes(headers, []string{"Description", "Amount", "Date", "amount"})
+	want := []int{3, 1, 0}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ColumnIndexes() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	log "golang.org/x/exp/slog"
+)
+
+// TransferColumn is the column added to every row by transfer detection,
+// holding the ID shared by the two rows of a transfer.
+const TransferColumn = "TransferID"
+
+// DefaultTransferDays is the number of days the two sides of a transfer may
+// be apart.
+const DefaultTransferDays = 3
+
+// Transfers configures the detection of money moved between accounts, e.g. a
+// card payment showing as -500 in the checking file and +500 in the card
+// file. Rows are paired when their amounts are opposite, they come from
+// different files and their dates are at most Days apart.
+type Transfers struct {
+	Days         int
+	DateColumn   string
+	AmountColumn string
+	// Drop leaves the rows of transfers out, e.g. to keep them out of spend
+	// reports, rather than tagging them with a TransferID.
+	Drop bool
+}
+
+// transferEntry is one candidate row of a transfer.
+type transferEntry struct {
+	seq   int
+	file  int
+	day   int64 // days since the epoch
+	cents int64
+}
+
+// transferMatcher holds the outcome of the first pass of transfer detection:
+// the ID of each row found to be part of a transfer.
+type transferMatcher struct {
+	opts  Transfers
+	ids   map[int]string
+	pairs int
+}
+
+// findTransfers runs the first pass of a combine detecting transfers,
+// ignoring the rows dropped by d.
+func (m *Merger) findTransfers(files []string, columns []string, d *deduper) *transferMatcher {
+	t := &transferMatcher{opts: *m.Transfers, ids: make(map[int]string)}
+	groups := make(map[int64][]transferEntry)
+	seq := 0
+	for i, f := range files {
+		s := m.scan(f, columns)
+		if s.requireColumns(t.opts.DateColumn, t.opts.AmountColumn) != nil {
+			for _, ok := s.next(); ok; _, ok = s.next() {
+				seq++
+			}
+			s.close()
+			continue
+		}
+		for record, ok := s.next(); ok; record, ok = s.next() {
+			n := seq
+			seq++
+			if d != nil && !d.keep(n) {
+				continue
+			}
+			date, ok := ParseDate(s.value(record, t.opts.DateColumn))
+			amount, ok2 := ParseNumber(s.value(record, t.opts.AmountColumn))
+			cents := int64(math.Round(amount * 100))
+			if !ok || !ok2 || cents == 0 {
+				continue
+			}
+			e := transferEntry{seq: n, file: i, day: date.Unix() / 86400, cents: cents}
+			abs := cents
+			if abs < 0 {
+				abs = -abs
+			}
+			groups[abs] = append(groups[abs], e)
+		}
+		s.close()
+	}
+
+	var pairs [][2]transferEntry
+	for _, entries := range groups {
+		pairs = append(pairs, t.pair(entries)...)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0].seq < pairs[j][0].seq })
+	for i, p := range pairs {
+		id := fmt.Sprintf("T%d", i+1)
+		t.ids[p[0].seq], t.ids[p[1].seq] = id, id
+	}
+	t.pairs = len(pairs)
+	log.Debug("transfers", "pairs", t.pairs, "days", t.opts.Days)
+	return t
+}
+
+// pair matches the outflows among entries of the same absolute amount with
+// the closest unmatched inflow of another file, earliest outflow first. Each
+// pair is returned with its earlier row first.
+func (t *transferMatcher) pair(entries []transferEntry) [][2]transferEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].day != entries[j].day {
+			return entries[i].day < entries[j].day
+		}
+		return entries[i].seq < entries[j].seq
+	})
+	matched := make([]bool, len(entries))
+	var pairs [][2]transferEntry
+	for i, out := range entries {
+		if out.cents > 0 {
+			continue
+		}
+		best := -1
+		var bestGap int64
+		for j, in := range entries {
+			if matched[j] || in.cents < 0 || in.file == out.file {
+				continue
+			}
+			gap := in.day - out.day
+			if gap < 0 {
+				gap = -gap
+			}
+			if gap <= int64(t.opts.Days) && (best < 0 || gap < bestGap) {
+				best, bestGap = j, gap
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		matched[i], matched[best] = true, true
+		p := [2]transferEntry{out, entries[best]}
+		if p[1].seq < p[0].seq {
+			p[0], p[1] = p[1], p[0]
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs
+}
+
+// id returns the TransferID of the row at position seq, blank when the row
+// is not part of a transfer.
+func (t *transferMatcher) id(seq int) string {
+	return t.ids[seq]
+}
+
+func (t *transferMatcher) report() string {
+	if t.pairs == 0 {
+		return "transfers: none found\n"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "transfers: %d found", t.pairs)
+	if t.opts.Drop {
+		fmt.Fprintf(&sb, ", %d rows dropped", 2*t.pairs)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// value returns the value of col in record as written to the output, i.e.
+// negated when col is listed in NegateColumns.
+func (s *fileScan) value(record []string, col string) string {
+	i, ok := s.index[col]
+	if !ok {
+		return ""
+	}
+	if s.negate[col] {
+		return NegateValue(record[i])
+	}
+	return record[i]
+}
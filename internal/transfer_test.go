@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCombineTransfers(t *testing.T) {
+	var tests = []struct {
+		name     string
+		opts     Transfers
+		expected string
+	}{
+		{"tag", Transfers{Days: 3}, `Date,Description,Amount,TransferID
+2024-03-01,Payroll,2500.00,
+2024-03-05,Card payment,-500.00,T1
+2024-03-06,Groceries,-80.00,
+2024-03-20,Transfer to savings,-500.00,
+2024-03-02,Books,-45.00,
+2024-03-07,Payment thank you,500.00,T1
+2024-03-10,Refund,80.00,
+`},
+		{"wider window", Transfers{Days: 4}, `Date,Description,Amount,TransferID
+2024-03-01,Payroll,2500.00,
+2024-03-05,Card payment,-500.00,T1
+2024-03-06,Groceries,-80.00,T2
+2024-03-20,Transfer to savings,-500.00,
+2024-03-02,Books,-45.00,
+2024-03-07,Payment thank you,500.00,T1
+2024-03-10,Refund,80.00,T2
+`},
+		{"drop", Transfers{Days: 3, Drop: true}, `Date,Description,Amount
+2024-03-01,Payroll,2500.00
+2024-03-06,Groceries,-80.00
+2024-03-20,Transfer to savings,-500.00
+2024-03-02,Books,-45.00
+2024-03-10,Refund,80.00
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.DateColumn, tt.opts.AmountColumn = "Date", "Amount"
+			m := &Merger{Transfers: &tt.opts, Unified: true}
+			w := bytes.NewBufferString("")
+			m.combine(csv.NewWriter(w), []string{"../cmd/fixtures/checking.csv", "../cmd/fixtures/card.csv"}, nil)
+			if w.String() != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestTransferPair(t *testing.T) {
+	tm := &transferMatcher{opts: Transfers{Days: 3}}
+	entries := []transferEntry{
+		{seq: 0, file: 0, day: 10, cents: -500},
+		{seq: 1, file: 0, day: 11, cents: 500}, // same file
+		{seq: 2, file: 1, day: 13, cents: 500},
+		{seq: 3, file: 1, day: 9, cents: 500}, // closer
+	}
+	pairs := tm.pair(entries)
+	if len(pairs) != 1 || pairs[0][0].seq != 0 || pairs[0][1].seq != 3 {
+		t.Errorf("pair() = %+v, want rows 0 and 3", pairs)
+	}
+}